@@ -0,0 +1,348 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/strutils"
+)
+
+// barrier state format: {generation}|{participant id}:{deadline in millisecond},...
+//	which takes about 38 bytes per participant.
+// latch state format: {count left}
+// Writing a state longer than the limit of a {ValueLimiter} fails with ErrValueTooLong.
+
+const (
+	DEFAULT_SYNC_EXPIRE time.Duration = 60 * time.Second
+	// SYNC_POLL_INTERVAL is the interval of checking state when waiting, no matter watch is supported or not
+	SYNC_POLL_INTERVAL time.Duration = 100 * time.Millisecond
+)
+
+var (
+	SyncExpired   = errors.New("Synchronizer state has expired")
+	SyncContended = errors.New("Too much contention on the synchronizer state")
+)
+
+type syncOptions struct {
+	expire time.Duration
+}
+
+type SyncOption func(o *syncOptions)
+
+// WithSyncExpire sets the expiration of abandoned participants of a barrier or
+//	an untouched latch
+func WithSyncExpire(expire time.Duration) SyncOption {
+	return func(o *syncOptions) {
+		if expire > 0 {
+			o.expire = expire
+		}
+	}
+}
+
+func newSyncOptions(opts []SyncOption) *syncOptions {
+	o := &syncOptions{
+		expire: DEFAULT_SYNC_EXPIRE,
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	return o
+}
+
+func syncKey(store Store, namespace, kind, name string) (*LockKey, error) {
+	if namespace == "" {
+		namespace = "distributed-lock"
+	}
+	return NewLockKey(store, nil, namespace, kind+"::"+name)
+}
+
+// update applies fn to the state with compare-and-swap until succeed
+//	fn returns the new state and whether to write it
+func update(store AtomicStore, key *LockKey, expire time.Duration, fn func(state string) (string, bool)) (string, error) {
+	for i := 0; i < 100; i++ {
+		old := store.Get(key)
+		next, write := fn(old)
+		if !write {
+			return next, nil
+		}
+		if err := checkValue(store, next); err != nil {
+			return "", err
+		}
+		if store.CompareAndSwap(key, old, next, expire) {
+			return next, nil
+		}
+	}
+	return "", SyncContended
+}
+
+// waitState invokes check whenever the state may have changed until it returns true
+func waitState(ctx context.Context, store Store, key *LockKey, check func() (bool, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var changed <-chan struct{}
+	if watcher, ok := store.(WatchStore); ok {
+		changed = watcher.Watch(ctx, key)
+	}
+	ticker := time.NewTicker(SYNC_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		if done, err := check(); done || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Barrier lets a fixed number of parties wait for each other and it can be reused
+//	after all parties arrived.
+type Barrier struct {
+	store AtomicStore
+	key   *LockKey
+	// err is returned by all operations if the key is illegal
+	err     error
+	parties int
+	expire  time.Duration
+	uuid    string
+	seq     int64
+}
+
+// NewBarrier returns a cyclic barrier which trips when {parties} participants are waiting
+//	namespace is used to separate different projects
+//	name identifies the barrier across the cluster, and all operations fail with ErrIllegalKey
+//	if the store doesn't accept it
+//	store decides which storage it uses
+func NewBarrier(namespace, name string, parties int, store AtomicStore, opts ...SyncOption) *Barrier {
+	o := newSyncOptions(opts)
+	key, err := syncKey(store, namespace, "barrier", name)
+	return &Barrier{
+		store:   store,
+		key:     key,
+		err:     err,
+		parties: parties,
+		expire:  o.expire,
+		uuid:    strutils.RandString(20),
+	}
+}
+
+type participant struct {
+	id       string
+	deadline int64
+}
+
+func parseBarrier(state string) (generation int64, participants []participant) {
+	pos := strings.IndexByte(state, '|')
+	if pos < 0 {
+		return
+	}
+	generation, err := strconv.ParseInt(state[:pos], 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	for _, str := range strings.Split(state[pos+1:], ",") {
+		sep := strings.LastIndexByte(str, ':')
+		if sep < 1 {
+			continue
+		}
+		deadline, err := strconv.ParseInt(str[sep+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		participants = append(participants, participant{str[:sep], deadline})
+	}
+	return
+}
+
+func formatBarrier(generation int64, participants []participant) string {
+	b := strings.Builder{}
+	b.WriteString(strconv.FormatInt(generation, 10))
+	b.WriteByte('|')
+	for i, p := range participants {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(p.id)
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatInt(p.deadline, 10))
+	}
+	return b.String()
+}
+
+// alive filters out the abandoned participants and the specified one
+func alive(participants []participant, exclude string) []participant {
+	now := time.Now().UnixNano() / 1e6
+	result := make([]participant, 0, len(participants))
+	for _, p := range participants {
+		if p.deadline >= now && p.id != exclude {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Wait blocks until all parties are waiting on the barrier or ctx is done.
+//	A participant waiting is kept alive automatically and it will be dropped
+//	from the barrier after {expire} once it's gone without leaving.
+func (b *Barrier) Wait(ctx context.Context) error {
+	if b.err != nil {
+		return b.err
+	}
+	id := fmt.Sprintf("%s-%d", b.uuid, atomic.AddInt64(&b.seq, 1))
+	var generation int64
+	var refreshed time.Time
+	join := func(state string) (string, bool) {
+		gen, participants := parseBarrier(state)
+		generation = gen
+		participants = append(alive(participants, id), participant{id, time.Now().Add(b.expire).UnixNano() / 1e6})
+		if len(participants) >= b.parties {
+			// trip and start next generation
+			return formatBarrier(gen+1, nil), true
+		}
+		return formatBarrier(gen, participants), true
+	}
+	state, err := update(b.store, b.key, b.expire, join)
+	if err != nil {
+		return err
+	}
+	refreshed = time.Now()
+	if gen, _ := parseBarrier(state); gen != generation {
+		return nil
+	}
+	err = waitState(ctx, b.store, b.key, func() (bool, error) {
+		state := b.store.Get(b.key)
+		if state == "" {
+			return false, SyncExpired
+		}
+		if gen, _ := parseBarrier(state); gen != generation {
+			return true, nil
+		}
+		if time.Since(refreshed) > b.expire/3 {
+			// keep myself alive
+			refreshed = time.Now()
+			if _, err := update(b.store, b.key, b.expire, func(state string) (string, bool) {
+				if gen, _ := parseBarrier(state); gen != generation {
+					return state, false
+				}
+				return join(state)
+			}); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		// leave the barrier
+		update(b.store, b.key, b.expire, func(state string) (string, bool) {
+			gen, participants := parseBarrier(state)
+			if state == "" || gen != generation {
+				return state, false
+			}
+			return formatBarrier(gen, alive(participants, id)), true
+		})
+	}
+	return err
+}
+
+// Waiting returns the number of alive participants waiting on the barrier currently
+func (b *Barrier) Waiting() int {
+	if b.err != nil {
+		return 0
+	}
+	_, participants := parseBarrier(b.store.Get(b.key))
+	return len(alive(participants, ""))
+}
+
+// CountDownLatch lets participants wait until a set of operations across the cluster completes
+type CountDownLatch struct {
+	store AtomicStore
+	key   *LockKey
+	// err is returned by all operations if the key is illegal
+	err    error
+	expire time.Duration
+}
+
+// NewCountDownLatch returns a latch initialized with {count} if it doesn't exist yet.
+//	The latch expires when no one counts it down during {expire}.
+//	namespace is used to separate different projects
+//	name identifies the latch across the cluster, and all operations fail with ErrIllegalKey
+//	if the store doesn't accept it
+//	store decides which storage it uses
+func NewCountDownLatch(namespace, name string, count int, store AtomicStore, opts ...SyncOption) *CountDownLatch {
+	o := newSyncOptions(opts)
+	key, err := syncKey(store, namespace, "latch", name)
+	l := &CountDownLatch{
+		store:  store,
+		key:    key,
+		err:    err,
+		expire: o.expire,
+	}
+	if err == nil {
+		store.CompareAndSwap(l.key, "", strconv.Itoa(count), l.expire)
+	}
+	return l
+}
+
+// CountDown decreases the count and releases all waiting ones when reaching zero
+func (l *CountDownLatch) CountDown() error {
+	if l.err != nil {
+		return l.err
+	}
+	expired := false
+	_, err := update(l.store, l.key, l.expire, func(state string) (string, bool) {
+		if state == "" {
+			expired = true
+			return state, false
+		}
+		count, _ := strconv.Atoi(state)
+		if count < 1 {
+			return state, false
+		}
+		return strconv.Itoa(count - 1), true
+	})
+	if err == nil && expired {
+		err = SyncExpired
+	}
+	return err
+}
+
+// Count returns current count or -1 if the latch has expired or its key is illegal
+func (l *CountDownLatch) Count() int {
+	if l.err != nil {
+		return -1
+	}
+	state := l.store.Get(l.key)
+	if state == "" {
+		return -1
+	}
+	count, _ := strconv.Atoi(state)
+	return count
+}
+
+// Wait blocks until the count reaches zero, the latch expires or ctx is done
+func (l *CountDownLatch) Wait(ctx context.Context) error {
+	if l.err != nil {
+		return l.err
+	}
+	return waitState(ctx, l.store, l.key, func() (bool, error) {
+		switch count := l.Count(); {
+		case count < 0:
+			return false, SyncExpired
+		case count == 0:
+			return true, nil
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,267 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+var CircuitOpen = errors.New("Circuit is open")
+
+//go:generate go run ./internal/breakergen
+
+// Breaker is a store wrapped by {NewBreaker}, which stops calling the store after continuous
+//	failures detected by {Ping} or on the data path, then probes it periodically until it
+//	recovers. Operations don't return errors, so a result which may be caused by an unreachable
+//	backend, like nothing read, a failed write or a write without result, is confirmed by pinging
+//	the wrapped store if it's a {Pinger}, at most once per probe interval.
+//	During the circuit is open reading returns nothing and writing is dropped.
+//	It implements the same optional interfaces, like AtomicStore or Lister, as the wrapped store.
+type Breaker interface {
+	Store
+	Pinger
+	// Available returns false if the circuit is open, and probes the store when it's time
+	Available() bool
+}
+
+// AtomicBreaker is a {Breaker} wrapping an AtomicStore
+type AtomicBreaker interface {
+	Breaker
+	AtomicStore
+}
+
+type breakerStore struct {
+	Store
+	mutex     sync.Mutex
+	threshold int
+	probe     time.Duration
+	failures  int
+	openUntil time.Time
+	// next time to confirm a suspicious result on the data path
+	confirmAfter time.Time
+}
+
+// NewBreaker returns a store wrapping the specified one
+//	threshold is the number of continuous failures to open the circuit
+//	probe is the interval to probe the store while the circuit is open
+func NewBreaker(store Store, threshold int, probe time.Duration) Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return breakers[capabilities(store)](&breakerStore{
+		Store:     store,
+		threshold: threshold,
+		probe:     probe,
+	})
+}
+
+// NewAtomicBreaker works like {NewBreaker} but keeps the result typed as an AtomicStore
+func NewAtomicBreaker(store AtomicStore, threshold int, probe time.Duration) AtomicBreaker {
+	return NewBreaker(store, threshold, probe).(AtomicBreaker)
+}
+
+func (b *breakerStore) ping() error {
+	if pinger, ok := b.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// observe records the result of an operation on the data path, and confirms the one
+//	which may be a failure by pinging, unless it was confirmed within the probe interval
+func (b *breakerStore) observe(ok bool) {
+	if ok {
+		b.record(nil)
+		return
+	}
+	if _, isPinger := b.Store.(Pinger); !isPinger {
+		return
+	}
+	b.mutex.Lock()
+	due := !time.Now().Before(b.confirmAfter)
+	if due {
+		b.confirmAfter = time.Now().Add(b.probe)
+	}
+	b.mutex.Unlock()
+	if due {
+		b.record(b.ping())
+	}
+}
+
+func (b *breakerStore) record(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		if b.failures >= b.threshold {
+			log.Info("Store has recovered, close the circuit")
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			log.Warn("Store is unavailable, open the circuit: ", err.Error())
+		}
+		b.openUntil = time.Now().Add(b.probe)
+	}
+}
+
+func (b *breakerStore) Available() bool {
+	b.mutex.Lock()
+	open := b.failures >= b.threshold
+	due := !time.Now().Before(b.openUntil)
+	if open && due {
+		// only one probe during each interval
+		b.openUntil = time.Now().Add(b.probe)
+	}
+	b.mutex.Unlock()
+	if !open {
+		return true
+	}
+	if !due {
+		return false
+	}
+	err := b.ping()
+	b.record(err)
+	return err == nil
+}
+
+// Ping checks the store and records the result, it fails fast when the circuit is open
+func (b *breakerStore) Ping() error {
+	if !b.Available() {
+		return CircuitOpen
+	}
+	err := b.ping()
+	b.record(err)
+	return err
+}
+
+func (b *breakerStore) Keep(lockKey *LockKey, val string, expire time.Duration) {
+	if b.Available() {
+		b.Store.Keep(lockKey, val, expire)
+		b.observe(false)
+	}
+}
+
+func (b *breakerStore) Exists(lockKey *LockKey) bool {
+	if !b.Available() {
+		return false
+	}
+	exists := b.Store.Exists(lockKey)
+	b.observe(exists)
+	return exists
+}
+
+func (b *breakerStore) Get(lockKey *LockKey) string {
+	if !b.Available() {
+		return ""
+	}
+	val := b.Store.Get(lockKey)
+	b.observe(val != "")
+	return val
+}
+
+func (b *breakerStore) SetIfAbsent(lockKey *LockKey, val string, expire time.Duration) bool {
+	if !b.Available() {
+		return false
+	}
+	succ := b.Store.SetIfAbsent(lockKey, val, expire)
+	b.observe(succ)
+	return succ
+}
+
+func (b *breakerStore) Set(lockKey *LockKey, val string, expire time.Duration) {
+	if b.Available() {
+		b.Store.Set(lockKey, val, expire)
+		b.observe(false)
+	}
+}
+
+func (b *breakerStore) Delete(lockKey *LockKey) {
+	if b.Available() {
+		b.Store.Delete(lockKey)
+		b.observe(false)
+	}
+}
+
+// breakerAtomic exposes CompareAndSwap of an AtomicStore through the circuit
+type breakerAtomic struct {
+	b *breakerStore
+}
+
+func (f breakerAtomic) CompareAndSwap(lockKey *LockKey, old, val string, expire time.Duration) bool {
+	if !f.b.Available() {
+		return false
+	}
+	succ := f.b.Store.(AtomicStore).CompareAndSwap(lockKey, old, val, expire)
+	f.b.observe(succ)
+	return succ
+}
+
+// breakerRenewer exposes Renew of a Renewer through the circuit
+type breakerRenewer struct {
+	b *breakerStore
+}
+
+func (f breakerRenewer) Renew(lockKey *LockKey, val string, expire time.Duration) bool {
+	if !f.b.Available() {
+		return false
+	}
+	renewed := f.b.Store.(Renewer).Renew(lockKey, val, expire)
+	f.b.observe(renewed)
+	return renewed
+}
+
+// breakerWatcher exposes Watch of a WatchStore
+type breakerWatcher struct {
+	b *breakerStore
+}
+
+func (f breakerWatcher) Watch(ctx context.Context, lockKey *LockKey) <-chan struct{} {
+	return f.b.Store.(WatchStore).Watch(ctx, lockKey)
+}
+
+// breakerNotifier exposes OnLost of a LossNotifier
+type breakerNotifier struct {
+	b *breakerStore
+}
+
+func (f breakerNotifier) OnLost(handler func(lockKey *LockKey)) (cancel func()) {
+	return f.b.Store.(LossNotifier).OnLost(handler)
+}
+
+// breakerLister exposes List of a Lister
+type breakerLister struct {
+	b *breakerStore
+}
+
+func (f breakerLister) List(namespace string) ([]Entry, error) {
+	return f.b.Store.(Lister).List(namespace)
+}
+
+// breakerValidator exposes ValidateKey of a KeyValidator
+type breakerValidator struct {
+	b *breakerStore
+}
+
+func (f breakerValidator) ValidateKey(lockKey *LockKey) error {
+	return f.b.Store.(KeyValidator).ValidateKey(lockKey)
+}
+
+// breakerLimiter exposes MaxValueLength of a ValueLimiter
+type breakerLimiter struct {
+	b *breakerStore
+}
+
+func (f breakerLimiter) MaxValueLength() int {
+	return f.b.Store.(ValueLimiter).MaxValueLength()
+}
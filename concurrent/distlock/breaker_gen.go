@@ -0,0 +1,1121 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+// Code generated by internal/breakergen. DO NOT EDIT.
+
+package distlock
+
+// capabilities returns the index of {breakers} whose bits mark the optional interfaces of store
+func capabilities(store Store) (index int) {
+	if _, ok := store.(AtomicStore); ok {
+		index |= 1
+	}
+	if _, ok := store.(WatchStore); ok {
+		index |= 2
+	}
+	if _, ok := store.(LossNotifier); ok {
+		index |= 4
+	}
+	if _, ok := store.(Lister); ok {
+		index |= 8
+	}
+	if _, ok := store.(KeyValidator); ok {
+		index |= 16
+	}
+	if _, ok := store.(ValueLimiter); ok {
+		index |= 32
+	}
+	if _, ok := store.(Renewer); ok {
+		index |= 64
+	}
+	return
+}
+
+// breakers compose the breaker with the facets marked by the bits of index
+var breakers = [...]func(b *breakerStore) Breaker{
+	func(b *breakerStore) Breaker { return b },
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+		}{b, breakerAtomic{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+		}{b, breakerWatcher{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+		}{b, breakerAtomic{b}, breakerWatcher{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+		}{b, breakerNotifier{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+		}{b, breakerAtomic{b}, breakerNotifier{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+		}{b, breakerWatcher{b}, breakerNotifier{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLister
+		}{b, breakerLister{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLister
+		}{b, breakerAtomic{b}, breakerLister{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLister
+		}{b, breakerWatcher{b}, breakerLister{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLister
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLister{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLister
+		}{b, breakerNotifier{b}, breakerLister{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLister
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLister{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerValidator
+		}{b, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerValidator
+		}{b, breakerAtomic{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerValidator
+		}{b, breakerWatcher{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerValidator
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerValidator
+		}{b, breakerNotifier{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerValidator
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerValidator
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerValidator
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLister
+			breakerValidator
+		}{b, breakerLister{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLister
+			breakerValidator
+		}{b, breakerAtomic{b}, breakerLister{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLister
+			breakerValidator
+		}{b, breakerWatcher{b}, breakerLister{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLister
+			breakerValidator
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLister{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLister
+			breakerValidator
+		}{b, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLister
+			breakerValidator
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerValidator
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerValidator
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLimiter
+		}{b, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLimiter
+		}{b, breakerWatcher{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLimiter
+		}{b, breakerNotifier{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLimiter
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLister
+			breakerLimiter
+		}{b, breakerLister{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLister
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerLister{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLister
+			breakerLimiter
+		}{b, breakerWatcher{b}, breakerLister{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLister
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLister{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLister
+			breakerLimiter
+		}{b, breakerNotifier{b}, breakerLister{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLister
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLister{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerLimiter
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerValidator
+			breakerLimiter
+		}{b, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerValidator
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerValidator
+			breakerLimiter
+		}{b, breakerWatcher{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerValidator
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerValidator
+			breakerLimiter
+		}{b, breakerNotifier{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerValidator
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerValidator
+			breakerLimiter
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerValidator
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLister
+			breakerValidator
+			breakerLimiter
+		}{b, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLister
+			breakerValidator
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLister
+			breakerValidator
+			breakerLimiter
+		}{b, breakerWatcher{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLister
+			breakerValidator
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerLimiter
+		}{b, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerLimiter
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerLimiter
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerRenewer
+		}{b, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerRenewer
+		}{b, breakerNotifier{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLister
+			breakerRenewer
+		}{b, breakerLister{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLister
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerLister{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLister
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerLister{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLister
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLister{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLister
+			breakerRenewer
+		}{b, breakerNotifier{b}, breakerLister{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLister
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLister{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerValidator
+			breakerRenewer
+		}{b, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerValidator
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerValidator
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerValidator
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerValidator
+			breakerRenewer
+		}{b, breakerNotifier{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerValidator
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerValidator
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerValidator
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLister
+			breakerValidator
+			breakerRenewer
+		}{b, breakerLister{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLister
+			breakerValidator
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerLister{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLister
+			breakerValidator
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerLister{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLister
+			breakerValidator
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLister{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerRenewer
+		}{b, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerNotifier{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLister
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerLister{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLister
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerLister{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLister
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerLister{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLister
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLister{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLister
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerNotifier{b}, breakerLister{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLister
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLister{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerNotifier{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerLister
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerLister
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerLister
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerLister
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+	func(b *breakerStore) Breaker {
+		return struct {
+			*breakerStore
+			breakerAtomic
+			breakerWatcher
+			breakerNotifier
+			breakerLister
+			breakerValidator
+			breakerLimiter
+			breakerRenewer
+		}{b, breakerAtomic{b}, breakerWatcher{b}, breakerNotifier{b}, breakerLister{b}, breakerValidator{b}, breakerLimiter{b}, breakerRenewer{b}}
+	},
+}
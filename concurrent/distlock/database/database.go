@@ -7,16 +7,15 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
-	"github.com/jasonjoo2010/godao"
-	"github.com/jasonjoo2010/godao/options"
-	"github.com/jasonjoo2010/godao/types"
 	"github.com/sirupsen/logrus"
 )
 
-// Lock table structure:
+// Lock table structure of MySQL, see README for the ones of other dialects or create it by WithAutoMigrate:
 // CREATE TABLE `lock` (
 //   `id` bigint NOT NULL AUTO_INCREMENT,
 //   `key` varchar(100) NOT NULL DEFAULT '',
@@ -25,33 +24,79 @@ import (
 //   `created` bigint NOT NULL DEFAULT '0',
 //   `expire` bigint NOT NULL DEFAULT '0',
 //   PRIMARY KEY (`id`),
-//   UNIQUE KEY `key` (`key`)
+//   UNIQUE KEY `key` (`key`),
+//   KEY `expire` (`expire`)
 // ) ENGINE=InnoDB;
 
 const (
-	millis = 1e6
+	// DEFAULT_MAX_KEY_LENGTH is the length of `key` column in the suggested schema
+	DEFAULT_MAX_KEY_LENGTH = 100
+
+	PING_TIMEOUT = 2 * time.Second
+
+	// DEFAULT_REAP_BATCH is the number of expired locks deleted by a statement of reaper
+	DEFAULT_REAP_BATCH = 100
 )
 
-type lockStruct struct {
-	Id      int64 `dao:"primary;auto_increment"`
-	Key     string
-	Value   string
-	Version int64 // reserved
-	Created int64
-	Expire  int64
-}
+// likeEscaper escapes the wildcards of LIKE by '!', which is an ordinary character in string
+//	literals of all dialects unlike backslash.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// columns of lock table inserted
+var columns = []string{"key", "value", "version", "created", "expire"}
 
 type databaseLockerConfig struct {
-	prefix string
-	table  string
+	prefix         string
+	table          string
+	maxKeyLength   int
+	maxValueLength int
+	dialect        Dialect
+	autoMigrate    bool
+	reapInterval   time.Duration
+	reapBatch      int
+}
+
+// statements are built once by dialect, where the time of expiration is always decided by the
+//	clock of database, in milliseconds since epoch.
+type statements struct {
+	get, keep, swap, replace, insertIgnore, delete, deleteExpired, list, reap string
+}
+
+func newStatements(d Dialect, table string, reapBatch int) statements {
+	t := d.Quote(table)
+	key, value, expire := d.Quote("key"), d.Quote("value"), d.Quote("expire")
+	now := d.Now()
+	// args of key, value and ttl in milliseconds
+	values := []string{d.Placeholder(1), d.Placeholder(2), "1", now, now + " + " + d.Placeholder(3)}
+	return statements{
+		get: "SELECT " + d.Quote("id") + ", " + value + ", " + expire + " - " + now + " FROM " + t +
+			" WHERE " + key + " = " + d.Placeholder(1),
+		keep: "UPDATE " + t + " SET " + value + " = " + d.Placeholder(1) + ", " + expire + " = " + now + " + " + d.Placeholder(2) +
+			" WHERE " + key + " = " + d.Placeholder(3),
+		swap: "UPDATE " + t + " SET " + value + " = " + d.Placeholder(1) + ", " + expire + " = " + now + " + " + d.Placeholder(2) +
+			" WHERE " + key + " = " + d.Placeholder(3) + " AND " + value + " = " + d.Placeholder(4) + " AND " + expire + " >= " + now,
+		replace:      d.Replace(table, "key", columns, values),
+		insertIgnore: d.InsertIgnore(table, "key", columns, values),
+		delete:       "DELETE FROM " + t + " WHERE " + key + " = " + d.Placeholder(1),
+		deleteExpired: "DELETE FROM " + t + " WHERE " + d.Quote("id") + " = " + d.Placeholder(1) +
+			" AND " + expire + " < " + now,
+		list: "SELECT " + key + ", " + value + ", " + expire + " - " + now + " FROM " + t +
+			" WHERE " + key + " LIKE " + d.Placeholder(1) + " ESCAPE '!' AND " + expire + " > " + now,
+		reap: d.DeleteLimit(table, expire+" < "+now, reapBatch),
+	}
 }
 
 type DatabaseLocker struct {
-	db      *sql.DB
-	dao     *godao.Dao
-	table   string
-	prefix  string
-	stopped bool
+	db             *sql.DB
+	sql            statements
+	table          string
+	prefix         string
+	maxKeyLength   int
+	maxValueLength int
+	stopped        bool
+	// stops reaper and waits for it
+	cancel context.CancelFunc
+	reaped chan struct{}
 }
 
 type Option func(cfg *databaseLockerConfig)
@@ -68,8 +113,62 @@ func WithTable(table string) Option {
 	}
 }
 
+// WithMaxKeyLength specifies the length of `key` column, DEFAULT_MAX_KEY_LENGTH by default
+func WithMaxKeyLength(length int) Option {
+	return func(cfg *databaseLockerConfig) {
+		cfg.maxKeyLength = length
+	}
+}
+
+// WithMaxValueLength specifies the length of `value` column, DEFAULT_VALUE_LENGTH by default.
+//	Values longer than it are refused by the locks and synchronizers as a distlock.ValueLimiter.
+func WithMaxValueLength(length int) Option {
+	return func(cfg *databaseLockerConfig) {
+		cfg.maxValueLength = length
+	}
+}
+
+// WithDialect specifies the dialect of database, MySQL by default
+func WithDialect(dialect Dialect) Option {
+	return func(cfg *databaseLockerConfig) {
+		cfg.dialect = dialect
+	}
+}
+
+// WithAutoMigrate creates lock table and indexes if they're missing, verifies the columns and
+//	adds the ones missing in older layouts when opening.
+func WithAutoMigrate() Option {
+	return func(cfg *databaseLockerConfig) {
+		cfg.autoMigrate = true
+	}
+}
+
+// WithReaper deletes the expired locks every interval in the background, at most batch ones
+//	by a statement, rather than only the ones read. A batch of 0 means DEFAULT_REAP_BATCH.
+func WithReaper(interval time.Duration, batch int) Option {
+	return func(cfg *databaseLockerConfig) {
+		cfg.reapInterval = interval
+		cfg.reapBatch = batch
+	}
+}
+
+// New works like {Open} but logs the error and returns nil when failed
 func New(db *sql.DB, opts ...Option) *DatabaseLocker {
-	lockerConfig := &databaseLockerConfig{}
+	instance, err := Open(db, opts...)
+	if err != nil {
+		logrus.Error("Can't initialize database locker: ", err.Error())
+		return nil
+	}
+	return instance
+}
+
+// Open returns a store on the lock table of db, which is created or migrated first if WithAutoMigrate
+func Open(db *sql.DB, opts ...Option) (*DatabaseLocker, error) {
+	lockerConfig := &databaseLockerConfig{
+		maxKeyLength:   DEFAULT_MAX_KEY_LENGTH,
+		maxValueLength: DEFAULT_VALUE_LENGTH,
+		dialect:        MySQL,
+	}
 	for _, fn := range opts {
 		fn(lockerConfig)
 	}
@@ -79,36 +178,58 @@ func New(db *sql.DB, opts ...Option) *DatabaseLocker {
 	if lockerConfig.table == "" {
 		lockerConfig.table = "lock"
 	}
-	return &DatabaseLocker{
-		db:     db,
-		dao:    godao.NewDao(lockStruct{}, db, options.WithTable(lockerConfig.table)),
-		table:  lockerConfig.table,
-		prefix: lockerConfig.prefix,
+	if lockerConfig.reapBatch <= 0 {
+		lockerConfig.reapBatch = DEFAULT_REAP_BATCH
+	}
+	if lockerConfig.maxValueLength < minValueLength {
+		return nil, fmt.Errorf("Length of value should be at least %d", minValueLength)
 	}
+	if lockerConfig.autoMigrate {
+		err := autoMigrate(context.Background(), db, lockerConfig.dialect, lockerConfig.table,
+			lockerConfig.maxKeyLength, lockerConfig.maxValueLength)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s := &DatabaseLocker{
+		db:             db,
+		sql:            newStatements(lockerConfig.dialect, lockerConfig.table, lockerConfig.reapBatch),
+		table:          lockerConfig.table,
+		prefix:         lockerConfig.prefix,
+		maxKeyLength:   lockerConfig.maxKeyLength,
+		maxValueLength: lockerConfig.maxValueLength,
+	}
+	if lockerConfig.reapInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		s.reaped = make(chan struct{})
+		go s.reap(ctx, lockerConfig.reapInterval, lockerConfig.reapBatch)
+	}
+	return s, nil
 }
 
 func (s *DatabaseLocker) key(lockKey *distlock.LockKey) string {
 	return s.prefix + "/" + lockKey.Namespace + "/" + lockKey.Key
 }
 
+// ValidateKey rejects keys longer than the `key` column
+func (s *DatabaseLocker) ValidateKey(lockKey *distlock.LockKey) error {
+	return distlock.ValidateKeyLength(s.key(lockKey), s.maxKeyLength)
+}
+
+// MaxValueLength is the length of `value` column
+func (s *DatabaseLocker) MaxValueLength() int {
+	return s.maxValueLength
+}
+
 func (s *DatabaseLocker) Keep(lockKey *distlock.LockKey, val string, expire time.Duration) {
-	affected, err := s.dao.UpdateBy(context.Background(), (&godao.Query{}).
-		Equal("Key", s.key(lockKey)).
-		Data(),
-		&types.UpdateEntry{
-			Field: "Value",
-			Value: val,
-		},
-		&types.UpdateEntry{
-			Field: "Expire",
-			Value: time.Now().Add(expire).UnixNano() / millis,
-		},
-	)
+	result, err := s.db.ExecContext(context.Background(), s.sql.keep,
+		val, expire.Milliseconds(), s.key(lockKey))
 	if err != nil {
 		logrus.Warn("Keep failed: ", err.Error())
 		return
 	}
-	if affected < 1 {
+	if affected, _ := result.RowsAffected(); affected < 1 {
 		logrus.Warn("Keep failed: no lock exists")
 		return
 	}
@@ -119,36 +240,39 @@ func (s *DatabaseLocker) Exists(lockKey *distlock.LockKey) bool {
 }
 
 func (s *DatabaseLocker) Get(lockKey *distlock.LockKey) string {
-	obj, err := s.dao.SelectOneBy(context.Background(), "Key", s.key(lockKey))
-	if err != nil {
-		logrus.Warn("Fetch data from database failed: ", err.Error())
+	var (
+		id    int64
+		value string
+		ttl   int64
+	)
+	err := s.db.QueryRowContext(context.Background(), s.sql.get, s.key(lockKey)).Scan(&id, &value, &ttl)
+	if err == sql.ErrNoRows {
 		return ""
 	}
-	if obj == nil {
+	if err != nil {
+		logrus.Warn("Fetch data from database failed: ", err.Error())
 		return ""
 	}
-	lockObj := obj.(*lockStruct)
-	if lockObj.Expire < time.Now().UnixNano()/millis {
+	if ttl < 0 {
 		// expired
-		logrus.Info("Release an expired lock: ", lockKey.Key, "@", lockKey.Namespace, " ", lockObj.Expire)
-		s.dao.Delete(context.Background(), lockObj.Id)
+		logrus.Info("Release an expired lock: ", lockKey.Key, "@", lockKey.Namespace, " ", ttl)
+		s.db.ExecContext(context.Background(), s.sql.deleteExpired, id)
 		return ""
 	}
-	return lockObj.Value
+	return value
 }
 
-func (s *DatabaseLocker) newLock(lockKey *distlock.LockKey, val string, expire time.Duration) *lockStruct {
-	return &lockStruct{
-		Key:     s.key(lockKey),
-		Value:   val,
-		Version: 1,
-		Created: time.Now().UnixNano() / millis,
-		Expire:  time.Now().Add(expire).UnixNano() / millis,
+// insert executes the statement inserting a lock
+func (s *DatabaseLocker) insert(query string, lockKey *distlock.LockKey, val string, expire time.Duration) (int64, error) {
+	result, err := s.db.ExecContext(context.Background(), query, s.key(lockKey), val, expire.Milliseconds())
+	if err != nil {
+		return 0, err
 	}
+	return result.RowsAffected()
 }
 
 func (s *DatabaseLocker) Set(lockKey *distlock.LockKey, val string, expire time.Duration) {
-	affected, _, err := s.dao.Insert(context.Background(), s.newLock(lockKey, val, expire), options.WithReplace())
+	affected, err := s.insert(s.sql.replace, lockKey, val, expire)
 	if err != nil {
 		logrus.Warn("Failed update: ", err.Error())
 		return
@@ -160,7 +284,7 @@ func (s *DatabaseLocker) Set(lockKey *distlock.LockKey, val string, expire time.
 }
 
 func (s *DatabaseLocker) SetIfAbsent(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
-	affected, _, err := s.dao.Insert(context.Background(), s.newLock(lockKey, val, expire), options.WithInsertIgnore())
+	affected, err := s.insert(s.sql.insertIgnore, lockKey, val, expire)
 	if err == nil && affected > 0 {
 		return true
 	}
@@ -171,12 +295,100 @@ func (s *DatabaseLocker) SetIfAbsent(lockKey *distlock.LockKey, val string, expi
 	return false
 }
 
+func (s *DatabaseLocker) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	if old == "" {
+		return s.SetIfAbsent(lockKey, val, expire)
+	}
+	result, err := s.db.ExecContext(context.Background(), s.sql.swap,
+		val, expire.Milliseconds(), s.key(lockKey), old)
+	if err != nil {
+		logrus.Warn("CompareAndSwap failed: ", err.Error())
+		return false
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0
+}
+
 func (s *DatabaseLocker) Delete(lockKey *distlock.LockKey) {
-	s.dao.DeleteRange(context.Background(), (&godao.Query{}).
-		Equal("Key", s.key(lockKey)).
-		Data())
+	s.db.ExecContext(context.Background(), s.sql.delete, s.key(lockKey))
 }
 
+func (s *DatabaseLocker) List(namespace string) ([]distlock.Entry, error) {
+	dir := s.prefix + "/" + namespace + "/"
+	rows, err := s.db.QueryContext(context.Background(), s.sql.list, likeEscaper.Replace(dir)+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []distlock.Entry
+	for rows.Next() {
+		var (
+			key, value string
+			ttl        int64
+		)
+		if err := rows.Scan(&key, &value, &ttl); err != nil {
+			return nil, err
+		}
+		key = strings.TrimPrefix(key, dir)
+		if strings.Contains(key, "/") {
+			// in a sub namespace
+			continue
+		}
+		entries = append(entries, distlock.Entry{
+			LockKey: distlock.LockKey{Namespace: namespace, Key: key},
+			Value:   value,
+			TTL:     time.Duration(ttl) * time.Millisecond,
+		})
+	}
+	return entries, rows.Err()
+}
+
+func (s *DatabaseLocker) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), PING_TIMEOUT)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// reap deletes the expired locks every interval until ctx is done
+func (s *DatabaseLocker) reap(ctx context.Context, interval time.Duration, batch int) {
+	defer close(s.reaped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if reaped := s.purge(ctx, batch); reaped > 0 {
+				logrus.Debug("Reaped ", reaped, " expired locks from ", s.table)
+			}
+		}
+	}
+}
+
+// purge deletes the expired locks batch by batch until fewer than batch ones are deleted
+func (s *DatabaseLocker) purge(ctx context.Context, batch int) int64 {
+	var total int64
+	for {
+		result, err := s.db.ExecContext(ctx, s.sql.reap)
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.Warn("Failed to reap expired locks: ", err.Error())
+			}
+			return total
+		}
+		affected, _ := result.RowsAffected()
+		total += affected
+		if affected < int64(batch) {
+			return total
+		}
+	}
+}
+
+// Close stops reaper if any, but leaves db open
 func (s *DatabaseLocker) Close() {
-	// do nothing
+	if s.cancel != nil {
+		s.cancel()
+		<-s.reaped
+	}
 }
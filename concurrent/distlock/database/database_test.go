@@ -6,10 +6,18 @@ package database
 
 import (
 	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
 	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +26,114 @@ func TestDatabase(t *testing.T) {
 	assert.Nil(t, err)
 	storetest.DoTest(t, New(db))
 }
+
+func TestPostgreSQL(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://postgres@127.0.0.1:5432/test?sslmode=disable")
+	assert.Nil(t, err)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS "lock" (
+		"id" bigserial PRIMARY KEY,
+		"key" varchar(100) NOT NULL DEFAULT '' UNIQUE,
+		"value" varchar(100) NOT NULL DEFAULT '',
+		"version" bigint NOT NULL DEFAULT 0,
+		"created" bigint NOT NULL DEFAULT 0,
+		"expire" bigint NOT NULL DEFAULT 0
+	)`)
+	assert.Nil(t, err)
+	storetest.DoTest(t, New(db, WithDialect(PostgreSQL)))
+	db.Close()
+}
+
+// openSQLite opens a database in a temporary file, removed when test finishes
+func openSQLite(t *testing.T) *sql.DB {
+	dir, err := ioutil.TempDir("", "distlock")
+	assert.Nil(t, err)
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, "lock.db")+"?_busy_timeout=5000")
+	assert.Nil(t, err)
+	// writers are serialized by sqlite anyway
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+	return db
+}
+
+func TestSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE "lock" (
+		"id" integer PRIMARY KEY AUTOINCREMENT,
+		"key" varchar(100) NOT NULL DEFAULT '' UNIQUE,
+		"value" varchar(100) NOT NULL DEFAULT '',
+		"version" bigint NOT NULL DEFAULT 0,
+		"created" bigint NOT NULL DEFAULT 0,
+		"expire" bigint NOT NULL DEFAULT 0
+	)`)
+	assert.Nil(t, err)
+	storetest.DoTest(t, New(db, WithDialect(SQLite), WithTable("lock")))
+}
+
+// skewedClock pretends the clock of database differs from the one of application by offset
+type skewedClock struct {
+	Dialect
+	offset time.Duration
+}
+
+func (d skewedClock) Now() string {
+	return "(" + d.Dialect.Now() + " + " + strconv.FormatInt(d.offset.Milliseconds(), 10) + ")"
+}
+
+func TestServerTime(t *testing.T) {
+	db := openSQLite(t)
+	dialect := skewedClock{SQLite, -time.Hour}
+	store, err := Open(db, WithDialect(dialect), WithAutoMigrate())
+	assert.Nil(t, err)
+	key := &distlock.LockKey{Namespace: "testns", Key: "a"}
+
+	assert.True(t, store.SetIfAbsent(key, "v", time.Second))
+	var ttl int64
+	assert.Nil(t, db.QueryRow(`SELECT "expire" - `+dialect.Now()+` FROM "lock"`).Scan(&ttl))
+	assert.InDelta(t, 1000, ttl, 100)
+	entries, err := store.List("testns")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.InDelta(t, time.Second, entries[0].TTL, float64(100*time.Millisecond))
+
+	// expired by the clock of database, an hour behind
+	time.Sleep(1100 * time.Millisecond)
+	assert.False(t, store.Exists(key))
+	assert.True(t, store.SetIfAbsent(key, "v", time.Second))
+
+	// an expired one is never revived by swapping
+	time.Sleep(1100 * time.Millisecond)
+	assert.False(t, store.CompareAndSwap(key, "v", "w", time.Second))
+	assert.Equal(t, "", store.Get(key))
+}
+
+func TestReaper(t *testing.T) {
+	db := openSQLite(t)
+	store, err := Open(db, WithDialect(SQLite), WithAutoMigrate(), WithReaper(50*time.Millisecond, 10))
+	assert.Nil(t, err)
+	expired := func(n int) {
+		for i := 0; i < n; i++ {
+			_, err := db.Exec(`INSERT INTO "lock" ("key", "value", "expire") VALUES (?, 'v', `+SQLite.Now()+` - 1000)`,
+				"/lock/testns/expired"+strconv.Itoa(i))
+			assert.Nil(t, err)
+		}
+	}
+	count := func() (n int) {
+		assert.Nil(t, db.QueryRow(`SELECT COUNT(*) FROM "lock"`).Scan(&n))
+		return
+	}
+
+	expired(25)
+	assert.True(t, store.SetIfAbsent(&distlock.LockKey{Namespace: "testns", Key: "held"}, "v", 5*time.Second))
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 1, count())
+
+	// stopped
+	store.Close()
+	expired(3)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 4, count())
+	store.Close()
+}
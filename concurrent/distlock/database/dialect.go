@@ -0,0 +1,256 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Dialect builds the statements which differ among databases
+type Dialect interface {
+	// Quote quotes the name of table or column
+	Quote(name string) string
+	// Placeholder returns the placeholder of the i-th argument, starting from 1
+	Placeholder(i int) string
+	// Now returns the expression of current time of database in milliseconds since epoch
+	Now() string
+	// InsertIgnore returns the statement inserting a row of columns with the expressions of values
+	//	unless the unique key conflicts.
+	InsertIgnore(table, key string, columns, values []string) string
+	// Replace returns the statement inserting a row of columns with the expressions of values or
+	//	replacing the one of the same key.
+	Replace(table, key string, columns, values []string) string
+	// DeleteLimit returns the statement deleting at most limit rows matching the condition
+	DeleteLimit(table, where string, limit int) string
+	// CreateTable returns the statements creating lock table and its indexes if they're missing
+	CreateTable(table string, keyLength, valueLength int) []string
+	// Columns returns the columns of table by name, or nothing if table doesn't exist
+	Columns(ctx context.Context, db *sql.DB, table string) (map[string]Column, error)
+}
+
+var (
+	// MySQL is the default dialect using INSERT IGNORE and REPLACE
+	MySQL Dialect = mysqlDialect{}
+	// PostgreSQL uses INSERT ... ON CONFLICT, which requires 9.5 or later
+	PostgreSQL Dialect = postgresDialect{}
+	// SQLite uses INSERT OR IGNORE and INSERT OR REPLACE
+	SQLite Dialect = sqliteDialect{}
+)
+
+// insert returns "<verb> <table> (<columns>) VALUES (<values>)"
+func insert(d Dialect, verb, table string, columns, values []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = d.Quote(c)
+	}
+	return verb + " " + d.Quote(table) +
+		" (" + strings.Join(quoted, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
+}
+
+// deleteByID deletes rows by the ids selected with limit, where DELETE ... LIMIT isn't supported
+func deleteByID(d Dialect, table, where string, limit int) string {
+	return "DELETE FROM " + d.Quote(table) + " WHERE " + d.Quote("id") + " IN (SELECT " + d.Quote("id") +
+		" FROM " + d.Quote(table) + " WHERE " + where + " LIMIT " + strconv.Itoa(limit) + ")"
+}
+
+// queryColumns reads the columns of table from rows of name, data type and length
+func queryColumns(ctx context.Context, db *sql.DB, query, table string, typeOf func(dataType string) string) (map[string]Column, error) {
+	rows, err := db.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]Column)
+	for rows.Next() {
+		var (
+			name, dataType string
+			length         int
+		)
+		if err := rows.Scan(&name, &dataType, &length); err != nil {
+			return nil, err
+		}
+		columns[name] = Column{Type: typeOf(strings.ToLower(dataType)), Length: length}
+	}
+	return columns, rows.Err()
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (mysqlDialect) Placeholder(i int) string {
+	return "?"
+}
+
+func (mysqlDialect) Now() string {
+	return "CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED)"
+}
+
+func (d mysqlDialect) InsertIgnore(table, key string, columns, values []string) string {
+	return insert(d, "INSERT IGNORE INTO", table, columns, values)
+}
+
+func (d mysqlDialect) Replace(table, key string, columns, values []string) string {
+	return insert(d, "REPLACE INTO", table, columns, values)
+}
+
+func (d mysqlDialect) DeleteLimit(table, where string, limit int) string {
+	return "DELETE FROM " + d.Quote(table) + " WHERE " + where + " LIMIT " + strconv.Itoa(limit)
+}
+
+func (d mysqlDialect) CreateTable(table string, keyLength, valueLength int) []string {
+	return []string{"CREATE TABLE IF NOT EXISTS " + d.Quote(table) + " (\n" +
+		"  `id` bigint NOT NULL AUTO_INCREMENT,\n" +
+		"  `key` varchar(" + strconv.Itoa(keyLength) + ") NOT NULL DEFAULT '',\n" +
+		"  `value` varchar(" + strconv.Itoa(valueLength) + ") NOT NULL DEFAULT '',\n" +
+		"  `version` bigint NOT NULL DEFAULT '0',\n" +
+		"  `created` bigint NOT NULL DEFAULT '0',\n" +
+		"  `expire` bigint NOT NULL DEFAULT '0',\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `key` (`key`),\n" +
+		"  KEY `expire` (`expire`)\n" +
+		") ENGINE=InnoDB"}
+}
+
+func (mysqlDialect) Columns(ctx context.Context, db *sql.DB, table string) (map[string]Column, error) {
+	return queryColumns(ctx, db, "SELECT `column_name`, `data_type`, COALESCE(`character_maximum_length`, 0)"+
+		" FROM `information_schema`.`columns` WHERE `table_schema` = DATABASE() AND `table_name` = ?",
+		table,
+		func(dataType string) string {
+			switch dataType {
+			case "bigint":
+				return TYPE_INT64
+			case "char", "varchar", "text", "mediumtext", "longtext":
+				return TYPE_STRING
+			}
+			return dataType
+		})
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (postgresDialect) Placeholder(i int) string {
+	return "$" + strconv.Itoa(i)
+}
+
+func (postgresDialect) Now() string {
+	return "CAST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP) * 1000 AS BIGINT)"
+}
+
+func (d postgresDialect) InsertIgnore(table, key string, columns, values []string) string {
+	return insert(d, "INSERT INTO", table, columns, values) + " ON CONFLICT (" + d.Quote(key) + ") DO NOTHING"
+}
+
+func (d postgresDialect) Replace(table, key string, columns, values []string) string {
+	updates := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if c == key {
+			continue
+		}
+		updates = append(updates, d.Quote(c)+" = EXCLUDED."+d.Quote(c))
+	}
+	return insert(d, "INSERT INTO", table, columns, values) +
+		" ON CONFLICT (" + d.Quote(key) + ") DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+func (d postgresDialect) DeleteLimit(table, where string, limit int) string {
+	return deleteByID(d, table, where, limit)
+}
+
+func (d postgresDialect) CreateTable(table string, keyLength, valueLength int) []string {
+	return []string{
+		"CREATE TABLE IF NOT EXISTS " + d.Quote(table) + ` (
+  "id" bigserial PRIMARY KEY,
+  "key" varchar(` + strconv.Itoa(keyLength) + `) NOT NULL DEFAULT '' UNIQUE,
+  "value" varchar(` + strconv.Itoa(valueLength) + `) NOT NULL DEFAULT '',
+  "version" bigint NOT NULL DEFAULT 0,
+  "created" bigint NOT NULL DEFAULT 0,
+  "expire" bigint NOT NULL DEFAULT 0
+)`,
+		"CREATE INDEX IF NOT EXISTS " + d.Quote(table+"_expire") + " ON " + d.Quote(table) + ` ("expire")`,
+	}
+}
+
+func (postgresDialect) Columns(ctx context.Context, db *sql.DB, table string) (map[string]Column, error) {
+	return queryColumns(ctx, db, "SELECT column_name, data_type, COALESCE(character_maximum_length, 0)"+
+		" FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1",
+		table,
+		func(dataType string) string {
+			switch dataType {
+			case "bigint":
+				return TYPE_INT64
+			case "character", "character varying", "text":
+				return TYPE_STRING
+			}
+			return dataType
+		})
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (sqliteDialect) Placeholder(i int) string {
+	return "?"
+}
+
+// Now is accurate to milliseconds by julian day, because unixepoch() requires 3.38 or later
+func (sqliteDialect) Now() string {
+	return "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)"
+}
+
+func (d sqliteDialect) InsertIgnore(table, key string, columns, values []string) string {
+	return insert(d, "INSERT OR IGNORE INTO", table, columns, values)
+}
+
+func (d sqliteDialect) Replace(table, key string, columns, values []string) string {
+	return insert(d, "INSERT OR REPLACE INTO", table, columns, values)
+}
+
+// DeleteLimit doesn't use DELETE ... LIMIT, which is supported only if sqlite is compiled with it
+func (d sqliteDialect) DeleteLimit(table, where string, limit int) string {
+	return deleteByID(d, table, where, limit)
+}
+
+func (d sqliteDialect) CreateTable(table string, keyLength, valueLength int) []string {
+	return []string{
+		"CREATE TABLE IF NOT EXISTS " + d.Quote(table) + ` (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "key" varchar(` + strconv.Itoa(keyLength) + `) NOT NULL DEFAULT '' UNIQUE,
+  "value" varchar(` + strconv.Itoa(valueLength) + `) NOT NULL DEFAULT '',
+  "version" bigint NOT NULL DEFAULT 0,
+  "created" bigint NOT NULL DEFAULT 0,
+  "expire" bigint NOT NULL DEFAULT 0
+)`,
+		"CREATE INDEX IF NOT EXISTS " + d.Quote(table+"_expire") + " ON " + d.Quote(table) + ` ("expire")`,
+	}
+}
+
+// Columns follows the rules of type affinity, where integers are all 64 bits and the lengths
+//	of strings are unlimited whatever declared.
+func (sqliteDialect) Columns(ctx context.Context, db *sql.DB, table string) (map[string]Column, error) {
+	return queryColumns(ctx, db, `SELECT "name", "type", 0 FROM pragma_table_info(?)`,
+		table,
+		func(dataType string) string {
+			switch {
+			case strings.Contains(dataType, "int"):
+				return TYPE_INT64
+			case strings.Contains(dataType, "char"), strings.Contains(dataType, "clob"), strings.Contains(dataType, "text"):
+				return TYPE_STRING
+			}
+			return dataType
+		})
+}
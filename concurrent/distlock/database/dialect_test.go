@@ -0,0 +1,49 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialects(t *testing.T) {
+	cols := []string{"key", "value"}
+	mysql := []string{"?", "?"}
+	assert.Equal(t, "INSERT IGNORE INTO `lock` (`key`, `value`) VALUES (?, ?)", MySQL.InsertIgnore("lock", "key", cols, mysql))
+	assert.Equal(t, "REPLACE INTO `lock` (`key`, `value`) VALUES (?, ?)", MySQL.Replace("lock", "key", cols, mysql))
+	assert.Equal(t, "DELETE FROM `lock` WHERE `expire` < 1 LIMIT 10", MySQL.DeleteLimit("lock", "`expire` < 1", 10))
+	postgres := []string{"$1", "$2"}
+	assert.Equal(t, `INSERT INTO "lock" ("key", "value") VALUES ($1, $2) ON CONFLICT ("key") DO NOTHING`,
+		PostgreSQL.InsertIgnore("lock", "key", cols, postgres))
+	assert.Equal(t, `INSERT INTO "lock" ("key", "value") VALUES ($1, $2) ON CONFLICT ("key") DO UPDATE SET "value" = EXCLUDED."value"`,
+		PostgreSQL.Replace("lock", "key", cols, postgres))
+	assert.Equal(t, `DELETE FROM "lock" WHERE "id" IN (SELECT "id" FROM "lock" WHERE "expire" < 1 LIMIT 10)`,
+		PostgreSQL.DeleteLimit("lock", `"expire" < 1`, 10))
+	assert.Equal(t, `INSERT OR IGNORE INTO "lock" ("key", "value") VALUES (?, ?)`, SQLite.InsertIgnore("lock", "key", cols, mysql))
+	assert.Equal(t, `INSERT OR REPLACE INTO "lock" ("key", "value") VALUES (?, ?)`, SQLite.Replace("lock", "key", cols, mysql))
+	assert.Equal(t, "`a``b`", MySQL.Quote("a`b"))
+	assert.Equal(t, `"a""b"`, PostgreSQL.Quote(`a"b`))
+}
+
+func TestStatements(t *testing.T) {
+	sql := newStatements(PostgreSQL, "lock", 10)
+	now := PostgreSQL.Now()
+	assert.Equal(t, `UPDATE "lock" SET "value" = $1, "expire" = `+now+` + $2 WHERE "key" = $3 AND "value" = $4 AND "expire" >= `+now, sql.swap)
+	assert.Equal(t, `SELECT "key", "value", "expire" - `+now+` FROM "lock" WHERE "key" LIKE $1 ESCAPE '!' AND "expire" > `+now, sql.list)
+	assert.Equal(t, `INSERT INTO "lock" ("key", "value", "version", "created", "expire") VALUES ($1, $2, 1, `+now+`, `+now+` + $3) ON CONFLICT ("key") DO NOTHING`,
+		sql.insertIgnore)
+	assert.Equal(t, "DELETE FROM `lock` WHERE `key` = ?", newStatements(MySQL, "lock", 10).delete)
+	assert.Equal(t, `/lock/a!_b!%!!/%`, likeEscaper.Replace("/lock/a_b%!/")+"%")
+}
+
+func TestNow(t *testing.T) {
+	db := openSQLite(t)
+	var now int64
+	assert.NoError(t, db.QueryRow("SELECT "+SQLite.Now()).Scan(&now))
+	assert.InDelta(t, time.Now().UnixNano()/int64(time.Millisecond), now, 1000)
+}
@@ -5,7 +5,8 @@ go 1.14
 require (
 	github.com/go-sql-driver/mysql v1.5.0 // test
 	github.com/jasonjoo2010/enhanced-utils v0.0.2
-	github.com/jasonjoo2010/godao v0.0.3
+	github.com/lib/pq v1.7.0 // test
+	github.com/mattn/go-sqlite3 v1.14.0 // test
 	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.5.1 // test
 )
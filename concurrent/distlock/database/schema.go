@@ -0,0 +1,94 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DEFAULT_VALUE_LENGTH is the length of `value` column in the suggested schema
+	DEFAULT_VALUE_LENGTH = 100
+
+	TYPE_INT64  = "int64"
+	TYPE_STRING = "string"
+
+	// minValueLength holds the shortest value of lock, {uuid}|{locked timestamp in millisecond}
+	minValueLength = 20 + 1 + 13
+)
+
+// ErrIncompatibleSchema indicates the existing lock table can't be used or migrated safely
+var ErrIncompatibleSchema = errors.New("Incompatible schema of lock table")
+
+// Column describes a column of lock table, whose Type is TYPE_INT64, TYPE_STRING or the
+//	declared one if it's neither. Length is the maximum length of string, 0 for unlimited.
+type Column struct {
+	Type   string
+	Length int
+}
+
+type layoutColumn struct {
+	name   string
+	column Column
+	// added to the tables of older layouts if missing, or required otherwise
+	optional   bool
+	definition string
+}
+
+// layout returns the columns expected in lock table. The owner, time and TTL of a lock are all
+//	kept in `value` column, so older layouts differ only in `version` and `created`, and no
+//	column of owner or token is needed.
+func layout(keyLength, valueLength int) []layoutColumn {
+	return []layoutColumn{
+		{name: "id", column: Column{Type: TYPE_INT64}},
+		{name: "key", column: Column{Type: TYPE_STRING, Length: keyLength}},
+		{name: "value", column: Column{Type: TYPE_STRING, Length: valueLength}},
+		{name: "version", column: Column{Type: TYPE_INT64}, optional: true, definition: "bigint NOT NULL DEFAULT 0"},
+		{name: "created", column: Column{Type: TYPE_INT64}, optional: true, definition: "bigint NOT NULL DEFAULT 0"},
+		{name: "expire", column: Column{Type: TYPE_INT64}},
+	}
+}
+
+// autoMigrate creates lock table if it's missing, verifies the columns and adds the optional ones
+//	missing. Columns are never changed or dropped.
+func autoMigrate(ctx context.Context, db *sql.DB, dialect Dialect, table string, keyLength, valueLength int) error {
+	for _, stmt := range dialect.CreateTable(table, keyLength, valueLength) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	columns, err := dialect.Columns(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	for _, expected := range layout(keyLength, valueLength) {
+		c, ok := columns[expected.name]
+		if !ok {
+			if !expected.optional {
+				return fmt.Errorf("%w: column %s is missing", ErrIncompatibleSchema, expected.name)
+			}
+			logrus.Info("Add column ", expected.name, " to lock table ", table)
+			if _, err := db.ExecContext(ctx, "ALTER TABLE "+dialect.Quote(table)+
+				" ADD COLUMN "+dialect.Quote(expected.name)+" "+expected.definition); err != nil {
+				return err
+			}
+			continue
+		}
+		if c.Type != expected.column.Type {
+			return fmt.Errorf("%w: column %s is %s rather than %s",
+				ErrIncompatibleSchema, expected.name, c.Type, expected.column.Type)
+		}
+		if c.Length > 0 && c.Length < expected.column.Length {
+			return fmt.Errorf("%w: column %s is shorter than %d",
+				ErrIncompatibleSchema, expected.name, expected.column.Length)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoMigrate(t *testing.T) {
+	db := openSQLite(t)
+	store, err := Open(db, WithDialect(SQLite), WithTable("auto_lock"), WithAutoMigrate())
+	assert.NoError(t, err)
+	storetest.DoTest(t, store)
+
+	columns, err := SQLite.Columns(context.Background(), db, "auto_lock")
+	assert.NoError(t, err)
+	assert.Len(t, columns, 6)
+	var index string
+	assert.NoError(t, db.QueryRow(`SELECT "name" FROM sqlite_master WHERE "type" = 'index' AND "tbl_name" = 'auto_lock' AND "sql" LIKE '%expire%'`).Scan(&index))
+	assert.Equal(t, "auto_lock_expire", index)
+
+	// nothing changes for the second time
+	_, err = Open(db, WithDialect(SQLite), WithTable("auto_lock"), WithAutoMigrate())
+	assert.NoError(t, err)
+}
+
+func TestMigrateOlderLayout(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE "lock" (
+		"id" integer PRIMARY KEY AUTOINCREMENT,
+		"key" varchar(100) NOT NULL DEFAULT '' UNIQUE,
+		"value" varchar(100) NOT NULL DEFAULT '',
+		"expire" bigint NOT NULL DEFAULT 0
+	)`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO "lock" ("key", "value", "expire") VALUES ('/lock/testns/a', 'held', ` + SQLite.Now() + ` + 60000)`)
+	assert.NoError(t, err)
+
+	store, err := Open(db, WithDialect(SQLite), WithAutoMigrate())
+	assert.NoError(t, err)
+	columns, err := SQLite.Columns(context.Background(), db, "lock")
+	assert.NoError(t, err)
+	assert.Equal(t, Column{Type: TYPE_INT64}, columns["version"])
+	assert.Equal(t, Column{Type: TYPE_INT64}, columns["created"])
+
+	// existing locks are kept
+	key := &distlock.LockKey{Namespace: "testns", Key: "a"}
+	assert.Equal(t, "held", store.Get(key))
+	assert.False(t, store.SetIfAbsent(key, "other", time.Second))
+	store.Delete(key)
+	assert.True(t, store.SetIfAbsent(key, "other", time.Second))
+}
+
+func TestIncompatibleSchema(t *testing.T) {
+	db := openSQLite(t)
+	for table, ddl := range map[string]string{
+		"no_value": `CREATE TABLE "no_value" (
+			"id" integer PRIMARY KEY AUTOINCREMENT,
+			"key" varchar(100) NOT NULL DEFAULT '' UNIQUE,
+			"expire" bigint NOT NULL DEFAULT 0
+		)`,
+		"text_expire": `CREATE TABLE "text_expire" (
+			"id" integer PRIMARY KEY AUTOINCREMENT,
+			"key" varchar(100) NOT NULL DEFAULT '' UNIQUE,
+			"value" varchar(100) NOT NULL DEFAULT '',
+			"expire" datetime
+		)`,
+	} {
+		_, err := db.Exec(ddl)
+		assert.NoError(t, err)
+		_, err = Open(db, WithDialect(SQLite), WithTable(table), WithAutoMigrate())
+		assert.True(t, errors.Is(err, ErrIncompatibleSchema), table)
+	}
+	assert.Nil(t, New(db, WithDialect(SQLite), WithTable("no_value"), WithAutoMigrate()))
+}
+
+// shortColumns pretends the database limits the lengths of strings
+type shortColumns struct {
+	Dialect
+}
+
+func (d shortColumns) Columns(ctx context.Context, db *sql.DB, table string) (map[string]Column, error) {
+	columns, err := d.Dialect.Columns(ctx, db, table)
+	for name, length := range map[string]int{"key": 50, "value": 60} {
+		if c, ok := columns[name]; ok {
+			c.Length = length
+			columns[name] = c
+		}
+	}
+	return columns, err
+}
+
+func TestShortColumns(t *testing.T) {
+	db := openSQLite(t)
+	_, err := Open(db, WithDialect(shortColumns{SQLite}), WithAutoMigrate())
+	assert.True(t, errors.Is(err, ErrIncompatibleSchema))
+	_, err = Open(db, WithDialect(shortColumns{SQLite}), WithMaxKeyLength(50), WithAutoMigrate())
+	assert.True(t, errors.Is(err, ErrIncompatibleSchema))
+	store, err := Open(db, WithDialect(shortColumns{SQLite}), WithMaxKeyLength(50), WithMaxValueLength(60), WithAutoMigrate())
+	assert.NoError(t, err)
+	assert.Equal(t, 60, store.MaxValueLength())
+
+	// too short for any lock
+	_, err = Open(db, WithDialect(SQLite), WithMaxValueLength(20))
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrIllegalKey indicates the key of target can't be encoded or isn't accepted by store
+var ErrIllegalKey = errors.New("Illegal key")
+
+// KeyEncoder encodes the target of lock into the key in store
+type KeyEncoder interface {
+	Encode(target interface{}) (string, error)
+}
+
+// KeyValidator is implemented by stores having constraints on keys
+type KeyValidator interface {
+	// ValidateKey returns an error wrapping ErrIllegalKey if the key isn't accepted
+	ValidateKey(lockKey *LockKey) error
+}
+
+// KeyEncoderFunc adapts a function to a custom KeyEncoder
+type KeyEncoderFunc func(target interface{}) (string, error)
+
+func (f KeyEncoderFunc) Encode(target interface{}) (string, error) {
+	return f(target)
+}
+
+// NewLockKey encodes target into the key of namespace by encoder, DefaultKeyEncoder if nil,
+//	and validates it if store is a KeyValidator. Every primitive built on stores, like locks
+//	of backends, barriers and limiters, builds keys by it.
+func NewLockKey(store Store, encoder KeyEncoder, namespace string, target interface{}) (*LockKey, error) {
+	if encoder == nil {
+		encoder = DefaultKeyEncoder
+	}
+	key, err := encoder.Encode(target)
+	if err != nil {
+		if !errors.Is(err, ErrIllegalKey) {
+			err = fmt.Errorf("%w: %v", ErrIllegalKey, err)
+		}
+		return nil, err
+	}
+	lockKey := &LockKey{
+		Namespace: namespace,
+		Key:       key,
+	}
+	if validator, ok := store.(KeyValidator); ok {
+		if err := validator.ValidateKey(lockKey); err != nil {
+			return nil, err
+		}
+	}
+	return lockKey, nil
+}
+
+type defaultEncoder struct{}
+
+// DefaultKeyEncoder formats the target by "%v", the same as before.
+//	Targets of different types with the same print form share the same key.
+var DefaultKeyEncoder KeyEncoder = defaultEncoder{}
+
+func (defaultEncoder) Encode(target interface{}) (string, error) {
+	return fmt.Sprintf("%v", target), nil
+}
+
+type hashedEncoder struct {
+	prefix string
+}
+
+// HashedKeyEncoder encodes the type and value of target into a fixed length key
+//	as {prefix}{sha1 in hex}, which suits stores limiting the length of keys.
+func HashedKeyEncoder(prefix string) KeyEncoder {
+	return &hashedEncoder{prefix: prefix}
+}
+
+func (e *hashedEncoder) Encode(target interface{}) (string, error) {
+	hash := sha1.Sum([]byte(fmt.Sprintf("%T|%v", target, target)))
+	return e.prefix + hex.EncodeToString(hash[:]), nil
+}
+
+type escapedEncoder struct{}
+
+// EscapedKeyEncoder escapes the "%v" form of target to be a single path segment,
+//	so '/' in it won't break the layouts of etcd or zookeeper.
+var EscapedKeyEncoder KeyEncoder = escapedEncoder{}
+
+func (escapedEncoder) Encode(target interface{}) (string, error) {
+	key, err := DefaultKeyEncoder.Encode(target)
+	if err != nil {
+		return "", err
+	}
+	key = url.PathEscape(key)
+	switch key {
+	case ".":
+		return "%2E", nil
+	case "..":
+		return "%2E%2E", nil
+	}
+	return key, nil
+}
+
+// ValidatePathKey checks the key can be used as a single segment of path,
+//	used by stores organizing keys in paths.
+func ValidatePathKey(lockKey *LockKey) error {
+	if lockKey.Key == "" {
+		return fmt.Errorf("%w: empty", ErrIllegalKey)
+	}
+	if lockKey.Key == "." || lockKey.Key == ".." {
+		return fmt.Errorf("%w: %s is reserved", ErrIllegalKey, lockKey.Key)
+	}
+	if strings.ContainsAny(lockKey.Key, "/\x00") {
+		return fmt.Errorf("%w: %q contains '/' or null, try EscapedKeyEncoder", ErrIllegalKey, lockKey.Key)
+	}
+	return nil
+}
+
+// ValidateKeyLength checks the total length of key in store
+func ValidateKeyLength(key string, max int) error {
+	if max > 0 && len(key) > max {
+		return fmt.Errorf("%w: %q is longer than %d, try HashedKeyEncoder", ErrIllegalKey, key, max)
+	}
+	return nil
+}
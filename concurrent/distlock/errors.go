@@ -0,0 +1,62 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrTimeout indicates the lock couldn't be acquired during the wait
+	ErrTimeout = fmt.Errorf("%w: timeout", LockFailed)
+	// ErrStoreUnavailable indicates the backend of store can't be reached
+	ErrStoreUnavailable = errors.New("Store is unavailable")
+	// ErrNotOwner indicates the lock isn't held by myself
+	ErrNotOwner = errors.New("Lock is not held by myself")
+	// ErrNotLister indicates the store can't enumerate its locks
+	ErrNotLister = errors.New("Store doesn't support listing")
+	// ErrValueTooLong indicates the value exceeds the limit of a {ValueLimiter}
+	ErrValueTooLong = errors.New("Value is too long for the store")
+)
+
+// LockInfo describes the data of a lock
+type LockInfo struct {
+	Owner string
+	// Locked is when it's locked or renewed lastly, or written lastly in a {Renewer} store
+	Locked time.Time
+	// TTL is the expiration specified by {WithTTL}, zero for the default one of owner
+	TTL time.Duration
+	// Metadata is attached by {WithMetadata}
+	Metadata string
+}
+
+// ErrHeld indicates the lock is held by another owner
+type ErrHeld struct {
+	LockInfo
+	// Remaining is the time left before the lock expires, zero if unknown
+	Remaining time.Duration
+}
+
+func (e *ErrHeld) Error() string {
+	if e.Owner == "" {
+		return "Lock is held by others"
+	}
+	if e.Remaining <= 0 {
+		return fmt.Sprintf("Lock is held by %s since %s", e.Owner, e.Locked.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("Lock is held by %s since %s and expires in %v",
+		e.Owner, e.Locked.Format(time.RFC3339), e.Remaining)
+}
+
+// Is makes errors.Is(err, LockFailed) true for ErrHeld
+func (e *ErrHeld) Is(target error) bool {
+	return target == LockFailed
+}
+
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %v", ErrStoreUnavailable, err)
+}
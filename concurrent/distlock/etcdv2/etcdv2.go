@@ -6,6 +6,9 @@ package etcdv2
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"path"
 	"time"
 
 	etcd "github.com/coreos/etcd/client"
@@ -13,8 +16,11 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const PING_TIMEOUT = 2 * time.Second
+
 type etcdv2LockerConfig struct {
 	prefix, username, password string
+	tls                        *distlock.TLSConfig
 }
 
 type Etcdv2Locker struct {
@@ -39,6 +45,13 @@ func WithPrefix(prefix string) Option {
 	}
 }
 
+// WithTLS connects to the https endpoints with the certificates specified
+func WithTLS(tls distlock.TLSConfig) Option {
+	return func(cfg *etcdv2LockerConfig) {
+		cfg.tls = &tls
+	}
+}
+
 func New(addrs []string, opts ...Option) *Etcdv2Locker {
 	lockerConfig := &etcdv2LockerConfig{}
 	for _, fn := range opts {
@@ -51,6 +64,23 @@ func New(addrs []string, opts ...Option) *Etcdv2Locker {
 		cfg.Username = lockerConfig.username
 		cfg.Password = lockerConfig.password
 	}
+	if lockerConfig.tls != nil {
+		tlsConfig, err := lockerConfig.tls.Build()
+		if err != nil {
+			logrus.Error("Failed to create locker store based on etcdv2: " + err.Error())
+			return nil
+		}
+		// the same as etcd.DefaultTransport except the TLS config
+		cfg.Transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     tlsConfig,
+		}
+	}
 	if lockerConfig.prefix == "" {
 		lockerConfig.prefix = "/lock"
 	}
@@ -70,6 +100,11 @@ func (s *Etcdv2Locker) key(lockKey *distlock.LockKey) string {
 	return s.prefix + "/" + lockKey.Namespace + "/" + lockKey.Key
 }
 
+// ValidateKey rejects keys which can't be a single node of path
+func (s *Etcdv2Locker) ValidateKey(lockKey *distlock.LockKey) error {
+	return distlock.ValidatePathKey(lockKey)
+}
+
 func (s *Etcdv2Locker) Keep(lockKey *distlock.LockKey, val string, expire time.Duration) {
 	_, err := s.keysApi.Set(context.Background(), s.key(lockKey), val, &etcd.SetOptions{
 		TTL:       expire,
@@ -122,10 +157,94 @@ func (s *Etcdv2Locker) SetIfAbsent(lockKey *distlock.LockKey, val string, expire
 	return false
 }
 
+func (s *Etcdv2Locker) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	if old == "" {
+		return s.SetIfAbsent(lockKey, val, expire)
+	}
+	_, err := s.keysApi.Set(context.Background(), s.key(lockKey), val, &etcd.SetOptions{
+		TTL:       expire,
+		PrevValue: old,
+	})
+	if err == nil {
+		return true
+	}
+	if errEtcd, ok := err.(etcd.Error); ok &&
+		(errEtcd.Code == etcd.ErrorCodeTestFailed || errEtcd.Code == etcd.ErrorCodeKeyNotFound) {
+		return false
+	}
+	logrus.Warn("CompareAndSwap failed: ", err.Error())
+	return false
+}
+
+func (s *Etcdv2Locker) List(namespace string) ([]distlock.Entry, error) {
+	dir := s.prefix + "/" + namespace
+	resp, err := s.keysApi.Get(context.Background(), dir, nil)
+	if err != nil {
+		if errEtcd, ok := err.(etcd.Error); ok && errEtcd.Code == etcd.ErrorCodeKeyNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	now := time.Now()
+	entries := make([]distlock.Entry, 0, len(resp.Node.Nodes))
+	for _, node := range resp.Node.Nodes {
+		if node.Dir || node.Value == "" {
+			continue
+		}
+		var ttl time.Duration
+		if node.Expiration != nil {
+			ttl = node.Expiration.Sub(now)
+			if ttl <= 0 {
+				continue
+			}
+		}
+		entries = append(entries, distlock.Entry{
+			LockKey: distlock.LockKey{Namespace: namespace, Key: path.Base(node.Key)},
+			Value:   node.Value,
+			TTL:     ttl,
+		})
+	}
+	return entries, nil
+}
+
+func (s *Etcdv2Locker) Watch(ctx context.Context, lockKey *distlock.LockKey) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	watcher := s.keysApi.Watcher(s.key(lockKey), nil)
+	go func() {
+		defer close(ch)
+		for {
+			if _, err := watcher.Next(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logrus.Warn("Watch failed: ", err.Error())
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch
+}
+
 func (s *Etcdv2Locker) Delete(lockKey *distlock.LockKey) {
 	s.keysApi.Delete(context.Background(), s.key(lockKey), nil)
 }
 
+func (s *Etcdv2Locker) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), PING_TIMEOUT)
+	defer cancel()
+	_, err := s.client.GetVersion(ctx)
+	return err
+}
+
 func (s *Etcdv2Locker) Close() {
 	// do nothing
 }
@@ -0,0 +1,62 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package etcdv2
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// version answers every request with the versions of etcd
+func version(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		body := `{"etcdserver":"2.3.8","etcdcluster":"2.3.0"}`
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			ContentLength: int64(len(body)),
+			Body:          ioutil.NopCloser(strings.NewReader(body)),
+			Request:       req,
+		}
+		if err := resp.Write(conn); err != nil {
+			return
+		}
+	}
+}
+
+func TestTLS(t *testing.T) {
+	f := storetest.NewTLSFixture(t)
+	addr, clients := f.Serve(t, version)
+
+	locker := New([]string{"https://" + addr}, WithTLS(f.Config()))
+	assert.NotNil(t, locker)
+	assert.NoError(t, locker.Ping())
+	assert.Equal(t, "client", <-clients)
+
+	// server isn't trusted
+	locker = New([]string{"https://" + addr}, WithTLS(distlock.TLSConfig{
+		CertFile: f.CertFile,
+		KeyFile:  f.KeyFile,
+	}))
+	assert.Error(t, locker.Ping())
+
+	assert.Nil(t, New([]string{"https://" + addr}, WithTLS(distlock.TLSConfig{CAFile: f.Dir + "/absent.pem"})))
+}
@@ -0,0 +1,304 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package etcdv3
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/sirupsen/logrus"
+)
+
+// Structure: <prefix>/<namespace>-concurrency/<key>/<lease id in hex>
+
+// CONCURRENCY_SUFFIX separates the keys of ConcurrencyLock from the ones of store
+const CONCURRENCY_SUFFIX = "-concurrency"
+
+// ConcurrencyLock is a lock built on the concurrency package of etcd. Every acquisition gets
+//	its own session whose lease is kept alive automatically until it's unlocked, and waits
+//	in the queue of target ordered by create revision, so it's fair. The create revision
+//	of the key held increases monotonically for a target and can be used as fencing token.
+type ConcurrencyLock struct {
+	locker    *Etcdv3Locker
+	namespace string
+	encoder   distlock.KeyEncoder
+	// sessions of locks held by prefixes
+	holdings *distlock.Holdings
+}
+
+type holding struct {
+	session  *concurrency.Session
+	revision int64
+}
+
+// NewConcurrencyMutex returns a non-reentry lock sharing the client and options of locker,
+//	the TTL of sessions is specified by WithTTL.
+func NewConcurrencyMutex(namespace string, locker *Etcdv3Locker) *ConcurrencyLock {
+	return newConcurrencyLock(namespace, locker, false)
+}
+
+// NewConcurrencyReentry returns a reentry lock sharing the client and options of locker
+func NewConcurrencyReentry(namespace string, locker *Etcdv3Locker) *ConcurrencyLock {
+	return newConcurrencyLock(namespace, locker, true)
+}
+
+func newConcurrencyLock(namespace string, locker *Etcdv3Locker, reentry bool) *ConcurrencyLock {
+	if namespace == "" {
+		namespace = "distributed-lock"
+	}
+	return &ConcurrencyLock{
+		locker:    locker,
+		namespace: namespace,
+		holdings:  distlock.NewHoldings("", reentry),
+	}
+}
+
+// SetKeyEncoder changes how targets are encoded into keys, distlock.DefaultKeyEncoder by default.
+//	It should be the same for all owners of a namespace.
+func (l *ConcurrencyLock) SetKeyEncoder(encoder distlock.KeyEncoder) {
+	l.encoder = encoder
+}
+
+// prefix returns the prefix of keys of target
+func (l *ConcurrencyLock) prefix(target interface{}) (string, error) {
+	lockKey, err := distlock.NewLockKey(l.locker, l.encoder, l.namespace+CONCURRENCY_SUFFIX, target)
+	if err != nil {
+		return "", err
+	}
+	l.locker.check()
+	return l.locker.key(lockKey), nil
+}
+
+func (l *ConcurrencyLock) newSession() (*concurrency.Session, error) {
+	return concurrency.NewSession(l.locker.client, concurrency.WithTTL(int(l.locker.defaultTTL)))
+}
+
+func (l *ConcurrencyLock) hold(pfx string, session *concurrency.Session, revision int64) {
+	l.holdings.Hold(pfx, &holding{
+		session:  session,
+		revision: revision,
+	})
+}
+
+func (l *ConcurrencyLock) TryLock(target interface{}) bool {
+	pfx, err := l.prefix(target)
+	if err != nil {
+		logrus.Warn("Can't lock ", target, ": ", err.Error())
+		return false
+	}
+	if reentered, err := l.holdings.Enter(pfx); reentered || err != nil {
+		return reentered
+	}
+	session, err := l.newSession()
+	if err != nil {
+		logrus.Warn("Create session failed: ", err.Error())
+		return false
+	}
+	// the same as concurrency.Mutex but doesn't wait
+	key := fmt.Sprintf("%s/%x", pfx, session.Lease())
+	resp, err := l.locker.client.Txn(context.Background()).
+		If(etcd.Compare(etcd.CreateRevision(key), "=", 0)).
+		Then(
+			etcd.OpPut(key, "", etcd.WithLease(session.Lease())),
+			etcd.OpGet(pfx+"/", etcd.WithFirstCreate()...),
+		).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		session.Close()
+		return false
+	}
+	revision := resp.Header.Revision
+	owner := resp.Responses[1].GetResponseRange().Kvs
+	if len(owner) > 0 && owner[0].CreateRevision != revision {
+		// revoking the lease removes the key
+		session.Close()
+		return false
+	}
+	l.hold(pfx, session, revision)
+	return true
+}
+
+// Lock waits in the queue of target in {wait} time or returns a LockFailed error.
+//	It fails immediately with an ErrHeld if a mutex has held target already.
+func (l *ConcurrencyLock) Lock(target interface{}, wait time.Duration) error {
+	pfx, err := l.prefix(target)
+	if err != nil {
+		logrus.Warn("Can't lock ", target, ": ", err.Error())
+		return distlock.LockFailed
+	}
+	if reentered, err := l.holdings.Enter(pfx); reentered || err != nil {
+		return err
+	}
+	session, err := l.newSession()
+	if err != nil {
+		logrus.Warn("Create session failed: ", err.Error())
+		return distlock.LockFailed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	mutex := concurrency.NewMutex(session, pfx)
+	if err := mutex.Lock(ctx); err != nil {
+		session.Close()
+		return distlock.LockFailed
+	}
+	resp, err := l.locker.kvApi.Get(context.Background(), mutex.Key())
+	if err != nil || resp.Count < 1 {
+		session.Close()
+		return distlock.LockFailed
+	}
+	l.hold(pfx, session, resp.Kvs[0].CreateRevision)
+	return nil
+}
+
+// Revision returns the create revision of the key held as fencing token
+func (l *ConcurrencyLock) Revision(target interface{}) (int64, bool) {
+	pfx, err := l.prefix(target)
+	if err != nil {
+		return 0, false
+	}
+	if h, ok := l.holdings.Get(pfx); ok {
+		return h.(*holding).revision, true
+	}
+	return 0, false
+}
+
+// Keep does nothing but checking the session is still alive, because it's kept alive automatically
+func (l *ConcurrencyLock) Keep(target interface{}) {
+	pfx, err := l.prefix(target)
+	if err != nil {
+		return
+	}
+	h, ok := l.holdings.Get(pfx)
+	if !ok {
+		return
+	}
+	select {
+	case <-h.(*holding).session.Done():
+		logrus.Warn("Lock of ", target, " has been lost")
+		l.holdings.Remove(pfx)
+	default:
+	}
+}
+
+func (l *ConcurrencyLock) UnLock(target interface{}) bool {
+	pfx, err := l.prefix(target)
+	if err != nil {
+		return false
+	}
+	h, held, last := l.holdings.Leave(pfx)
+	if !held {
+		return false
+	}
+	if !last {
+		return true
+	}
+	// revoking the lease removes the key
+	return h.(*holding).session.Close() == nil
+}
+
+// Close releases all locks held but leaves the client of locker open
+func (l *ConcurrencyLock) Close() {
+	for _, h := range l.holdings.Clear() {
+		h.(*holding).session.Close()
+	}
+}
+
+// Election elects a leader among the candidates of the same name based on the concurrency package
+type Election struct {
+	locker *Etcdv3Locker
+	prefix string
+	// err is returned by all operations if the name is illegal
+	err      error
+	mutex    sync.Mutex
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+// NewElection returns an election sharing the client and options of locker
+//	Campaign and Leader fail with distlock.ErrIllegalKey if the name isn't a legal key.
+func NewElection(namespace, name string, locker *Etcdv3Locker) *Election {
+	if namespace == "" {
+		namespace = "distributed-lock"
+	}
+	e := &Election{
+		locker: locker,
+	}
+	lockKey, err := distlock.NewLockKey(locker, nil, namespace+CONCURRENCY_SUFFIX, "election::"+name)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	e.prefix = locker.key(lockKey)
+	return e
+}
+
+// Campaign blocks until elected or ctx is done, and returns the create revision of
+//	the leader key as fencing token.
+func (e *Election) Campaign(ctx context.Context, value string) (int64, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.election != nil {
+		return e.election.Rev(), nil
+	}
+	session, err := concurrency.NewSession(e.locker.client, concurrency.WithTTL(int(e.locker.defaultTTL)))
+	if err != nil {
+		return 0, err
+	}
+	election := concurrency.NewElection(session, e.prefix)
+	if err := election.Campaign(ctx, value); err != nil {
+		session.Close()
+		return 0, err
+	}
+	e.session = session
+	e.election = election
+	return election.Rev(), nil
+}
+
+// Done returns a channel closed when the leadership is lost, or nil if not elected
+func (e *Election) Done() <-chan struct{} {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.session == nil {
+		return nil
+	}
+	return e.session.Done()
+}
+
+// Leader returns the value of current leader or empty if there isn't
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	if e.err != nil {
+		return "", e.err
+	}
+	resp, err := e.locker.kvApi.Get(ctx, e.prefix+"/", etcd.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// Resign gives up the leadership
+func (e *Election) Resign(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.election == nil {
+		return nil
+	}
+	err := e.election.Resign(ctx)
+	e.session.Close()
+	e.session = nil
+	e.election = nil
+	return err
+}
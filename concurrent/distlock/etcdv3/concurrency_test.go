@@ -0,0 +1,134 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyMutex(t *testing.T) {
+	store, _ := New([]string{"http://127.0.0.1:2379"}, WithTTL(5))
+	lock1 := NewConcurrencyMutex("testns", store)
+	lock2 := NewConcurrencyMutex("testns", store)
+	id := 1111
+
+	assert.True(t, lock1.TryLock(id))
+	assert.False(t, lock1.TryLock(id))
+	// fails fast rather than waits for myself
+	start := time.Now()
+	assert.True(t, errors.Is(lock1.Lock(id, time.Second), distlock.LockFailed))
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.False(t, lock2.TryLock(id))
+	assert.Error(t, lock2.Lock(id, 500*time.Millisecond))
+	rev1, ok := lock1.Revision(id)
+	assert.True(t, ok)
+	_, ok = lock2.Revision(id)
+	assert.False(t, ok)
+
+	assert.True(t, lock1.UnLock(id))
+	assert.False(t, lock1.UnLock(id))
+	assert.NoError(t, lock2.Lock(id, time.Second))
+	rev2, ok := lock2.Revision(id)
+	assert.True(t, ok)
+	// fencing token increases
+	assert.True(t, rev2 > rev1)
+	assert.True(t, lock2.UnLock(id))
+
+	lock1.Close()
+	lock2.Close()
+	store.Close()
+}
+
+func TestConcurrencyReentry(t *testing.T) {
+	store, _ := New([]string{"http://127.0.0.1:2379"}, WithTTL(5))
+	lock1 := NewConcurrencyReentry("testns", store)
+	lock2 := NewConcurrencyReentry("testns", store)
+	id := 2222
+
+	assert.True(t, lock1.TryLock(id))
+	assert.NoError(t, lock1.Lock(id, time.Second))
+	assert.False(t, lock2.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+	assert.False(t, lock2.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+	assert.True(t, lock2.TryLock(id))
+
+	// released by closing
+	lock2.Close()
+	assert.True(t, lock1.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+
+	lock1.Close()
+	store.Close()
+}
+
+func TestConcurrencyFairness(t *testing.T) {
+	store, _ := New([]string{"http://127.0.0.1:2379"}, WithTTL(5))
+	holder := NewConcurrencyMutex("testns", store)
+	id := 3333
+	assert.True(t, holder.TryLock(id))
+
+	var order []int
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lock := NewConcurrencyMutex("testns", store)
+			assert.NoError(t, lock.Lock(id, 5*time.Second))
+			mutex.Lock()
+			order = append(order, i)
+			mutex.Unlock()
+			assert.True(t, lock.UnLock(id))
+		}(i)
+		// queued in order
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.True(t, holder.UnLock(id))
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+
+	holder.Close()
+	store.Close()
+}
+
+func TestElection(t *testing.T) {
+	store, _ := New([]string{"http://127.0.0.1:2379"}, WithTTL(5))
+	e1 := NewElection("testns", "leader", store)
+	e2 := NewElection("testns", "leader", store)
+	assert.Nil(t, e1.Done())
+
+	rev1, err := e1.Campaign(context.Background(), "node1")
+	assert.NoError(t, err)
+	assert.NotNil(t, e1.Done())
+	leader, err := e2.Leader(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", leader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	_, err = e2.Campaign(ctx, "node2")
+	cancel()
+	assert.Error(t, err)
+
+	assert.NoError(t, e1.Resign(context.Background()))
+	rev2, err := e2.Campaign(context.Background(), "node2")
+	assert.NoError(t, err)
+	assert.True(t, rev2 > rev1)
+	leader, _ = e1.Leader(context.Background())
+	assert.Equal(t, "node2", leader)
+
+	assert.NoError(t, e2.Resign(context.Background()))
+	leader, _ = e1.Leader(context.Background())
+	assert.Empty(t, leader)
+	store.Close()
+}
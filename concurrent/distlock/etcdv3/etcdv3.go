@@ -6,6 +6,7 @@ package etcdv3
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	etcd "github.com/coreos/etcd/clientv3"
@@ -13,26 +14,30 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const PING_TIMEOUT = 2 * time.Second
+
 type Etcdv3Locker struct {
 	distlock.Store
 	client   *etcd.Client
 	kvApi    etcd.KV
 	leaseApi etcd.Lease
 	prefix   string
-	stopped  bool
+	// defaultTTL is the TTL in seconds of leases if expire isn't specified
+	defaultTTL int64
+	leases     leases
+	stopped    bool
 }
 
 func (s *Etcdv3Locker) Keep(lockKey *distlock.LockKey, val string, expire time.Duration) {
 	s.check()
 	key := s.key(lockKey)
-	_, err := s.kvApi.Txn(context.Background()).
-		If(s.notExisted(lockKey)).
-		Else(etcd.OpPut(key, val, etcd.WithLease(s.lease(expire)))).
-		Commit()
-	if err != nil {
-		logrus.Warn("Keep failed: ", err.Error())
-		return
-	}
+	s.withLease(key, val, expire, func(id etcd.LeaseID) (bool, error) {
+		resp, err := s.kvApi.Txn(context.Background()).
+			If(s.notExisted(lockKey)).
+			Else(etcd.OpPut(key, val, etcd.WithLease(id))).
+			Commit()
+		return err == nil && !resp.Succeeded, err
+	})
 }
 
 func (s *Etcdv3Locker) Exists(lockKey *distlock.LockKey) bool {
@@ -61,29 +66,115 @@ func (s *Etcdv3Locker) Get(lockKey *distlock.LockKey) string {
 func (s *Etcdv3Locker) SetIfAbsent(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
 	s.check()
 	key := s.key(lockKey)
-	resp, err := s.kvApi.Txn(context.Background()).
-		If(s.notExisted(lockKey)).
-		Then(etcd.OpPut(key, val, etcd.WithLease(s.lease(expire)))).
-		Commit()
-	if err != nil {
-		logrus.Warn("SetIfAbsent failed: ", err.Error())
-		return false
-	}
-	return resp.Succeeded
+	return s.withLease(key, val, expire, func(id etcd.LeaseID) (bool, error) {
+		resp, err := s.kvApi.Txn(context.Background()).
+			If(s.notExisted(lockKey)).
+			Then(etcd.OpPut(key, val, etcd.WithLease(id))).
+			Commit()
+		return err == nil && resp.Succeeded, err
+	})
 }
 
 func (s *Etcdv3Locker) Set(lockKey *distlock.LockKey, val string, expire time.Duration) {
 	s.check()
-	s.kvApi.Put(context.Background(), s.key(lockKey), val, etcd.WithLease(s.lease(expire)))
+	key := s.key(lockKey)
+	s.withLease(key, val, expire, func(id etcd.LeaseID) (bool, error) {
+		_, err := s.kvApi.Put(context.Background(), key, val, etcd.WithLease(id))
+		return err == nil, err
+	})
+}
+
+func (s *Etcdv3Locker) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	s.check()
+	key := s.key(lockKey)
+	cmp := etcd.Compare(etcd.Value(key), "=", old)
+	if old == "" {
+		cmp = s.notExisted(lockKey)
+	}
+	return s.withLease(key, val, expire, func(id etcd.LeaseID) (bool, error) {
+		resp, err := s.kvApi.Txn(context.Background()).
+			If(cmp).
+			Then(etcd.OpPut(key, val, etcd.WithLease(id))).
+			Commit()
+		return err == nil && resp.Succeeded, err
+	})
+}
+
+func (s *Etcdv3Locker) Watch(ctx context.Context, lockKey *distlock.LockKey) <-chan struct{} {
+	s.check()
+	ch := make(chan struct{}, 1)
+	watchC := s.client.Watch(ctx, s.key(lockKey))
+	go func() {
+		defer close(ch)
+		for range watchC {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch
+}
+
+func (s *Etcdv3Locker) List(namespace string) ([]distlock.Entry, error) {
+	s.check()
+	dir := s.prefix + "/" + namespace + "/"
+	resp, err := s.kvApi.Get(context.Background(), dir, etcd.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]distlock.Entry, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), dir)
+		if len(kv.Value) == 0 || strings.Contains(key, "/") {
+			continue
+		}
+		var ttl time.Duration
+		if kv.Lease != 0 {
+			leaseResp, err := s.leaseApi.TimeToLive(context.Background(), etcd.LeaseID(kv.Lease))
+			if err != nil {
+				return nil, err
+			}
+			if leaseResp.TTL <= 0 {
+				// expired
+				continue
+			}
+			ttl = time.Duration(leaseResp.TTL) * time.Second
+		}
+		entries = append(entries, distlock.Entry{
+			LockKey: distlock.LockKey{Namespace: namespace, Key: key},
+			Value:   string(kv.Value),
+			TTL:     ttl,
+		})
+	}
+	return entries, nil
 }
 
 func (s *Etcdv3Locker) Delete(lockKey *distlock.LockKey) {
 	s.check()
-	s.kvApi.Delete(context.Background(), s.key(lockKey))
+	key := s.key(lockKey)
+	defer s.serialize(key)()
+	s.kvApi.Delete(context.Background(), key)
+	s.leases.Lock()
+	e, ok := s.leases.entries[key]
+	delete(s.leases.entries, key)
+	s.leases.Unlock()
+	if ok {
+		s.revoke(e.id)
+	}
+}
+
+func (s *Etcdv3Locker) Ping() error {
+	s.check()
+	ctx, cancel := context.WithTimeout(context.Background(), PING_TIMEOUT)
+	defer cancel()
+	_, err := s.kvApi.Get(ctx, s.prefix, etcd.WithCountOnly())
+	return err
 }
 
 func (s *Etcdv3Locker) Close() {
 	s.check()
 	s.stopped = true
+	s.revokeAll()
 	s.client.Close()
 }
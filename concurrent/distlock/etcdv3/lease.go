@@ -0,0 +1,228 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package etcdv3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/sirupsen/logrus"
+)
+
+// Every lock written by current store gets its own lease, which is reused and kept alive
+//	by KeepAliveOnce when it's renewed with the same TTL, and revoked when it's deleted.
+//	Renewing a lock whose value is unchanged by {Renew} only keeps the lease alive without writing.
+//	Writes of the same key are serialized, or the lease recorded by a late one could be
+//	revoked by another.
+
+// SWEEP_THRESHOLD is the number of leases to start sweeping the expired ones
+const SWEEP_THRESHOLD = 1024
+
+type lease struct {
+	id       etcd.LeaseID
+	ttl      int64
+	deadline time.Time
+	// val is the value written with the lease lastly
+	val string
+}
+
+type leases struct {
+	sync.Mutex
+	entries map[string]*lease
+	writers map[string]*writer
+}
+
+// writer serializes the writes of a key, and is removed when nobody refers to it
+type writer struct {
+	sync.Mutex
+	refs int
+}
+
+// serialize waits until other writes of key finish and returns the function ending current one
+func (s *Etcdv3Locker) serialize(key string) func() {
+	s.leases.Lock()
+	if s.leases.writers == nil {
+		s.leases.writers = make(map[string]*writer)
+	}
+	w, ok := s.leases.writers[key]
+	if !ok {
+		w = &writer{}
+		s.leases.writers[key] = w
+	}
+	w.refs++
+	s.leases.Unlock()
+	w.Lock()
+	return func() {
+		w.Unlock()
+		s.leases.Lock()
+		w.refs--
+		if w.refs == 0 {
+			delete(s.leases.writers, key)
+		}
+		s.leases.Unlock()
+	}
+}
+
+// ttl returns the TTL in seconds of lease, WithTTL is used if expire isn't specified
+func (s *Etcdv3Locker) ttl(expire time.Duration) int64 {
+	if expire <= 0 {
+		return s.defaultTTL
+	}
+	return leaseTTL(expire)
+}
+
+// LeaseID returns the lease attached to the lock written by current store
+func (s *Etcdv3Locker) LeaseID(lockKey *distlock.LockKey) (etcd.LeaseID, bool) {
+	s.leases.Lock()
+	defer s.leases.Unlock()
+	if e, ok := s.leases.entries[s.key(lockKey)]; ok && time.Now().Before(e.deadline) {
+		return e.id, true
+	}
+	return etcd.NoLease, false
+}
+
+// lease returns a copy of the lease recorded for key
+func (s *Etcdv3Locker) lease(key string) (lease, bool) {
+	s.leases.Lock()
+	defer s.leases.Unlock()
+	if e, ok := s.leases.entries[key]; ok {
+		return *e, true
+	}
+	return lease{}, false
+}
+
+// keepAlive renews the lease of key by KeepAliveOnce, and forgets it if it has expired or been revoked
+func (s *Etcdv3Locker) keepAlive(key string, e lease) bool {
+	if _, err := s.leaseApi.KeepAliveOnce(context.Background(), e.id); err != nil {
+		s.forget(key, e.id)
+		return false
+	}
+	s.leases.Lock()
+	if current, ok := s.leases.entries[key]; ok && current.id == e.id {
+		current.deadline = time.Now().Add(time.Duration(e.ttl) * time.Second)
+	}
+	s.leases.Unlock()
+	return true
+}
+
+// obtain renews and returns the lease of key if it's alive with the same TTL,
+//	or grants a new one which isn't recorded yet.
+func (s *Etcdv3Locker) obtain(key string, ttl int64) (id etcd.LeaseID, reused bool, err error) {
+	if e, ok := s.lease(key); ok && e.ttl == ttl && s.keepAlive(key, e) {
+		return e.id, true, nil
+	}
+	resp, err := s.leaseApi.Grant(context.Background(), ttl)
+	if err != nil {
+		logrus.Warn("Create lease failed: ", err.Error())
+		return etcd.NoLease, false, err
+	}
+	return resp.ID, false, nil
+}
+
+// record makes the new lease of key reusable and revokes the previous one
+func (s *Etcdv3Locker) record(key string, id etcd.LeaseID, ttl int64, val string) {
+	now := time.Now()
+	s.leases.Lock()
+	if s.leases.entries == nil {
+		s.leases.entries = make(map[string]*lease)
+	}
+	old, ok := s.leases.entries[key]
+	s.leases.entries[key] = &lease{
+		id:       id,
+		ttl:      ttl,
+		deadline: now.Add(time.Duration(ttl) * time.Second),
+		val:      val,
+	}
+	if len(s.leases.entries) > SWEEP_THRESHOLD {
+		for k, e := range s.leases.entries {
+			if now.After(e.deadline) {
+				delete(s.leases.entries, k)
+			}
+		}
+	}
+	s.leases.Unlock()
+	if ok && old.id != id {
+		s.revoke(old.id)
+	}
+}
+
+// forget removes the lease of key if it's still the specified one
+func (s *Etcdv3Locker) forget(key string, id etcd.LeaseID) {
+	s.leases.Lock()
+	defer s.leases.Unlock()
+	if e, ok := s.leases.entries[key]; ok && e.id == id {
+		delete(s.leases.entries, key)
+	}
+}
+
+func (s *Etcdv3Locker) revoke(id etcd.LeaseID) {
+	_, err := s.leaseApi.Revoke(context.Background(), id)
+	if err != nil {
+		logrus.Warn("Revoke lease failed: ", err.Error())
+	}
+}
+
+// withLease runs fn writing val with the lease of key. A new lease is recorded if fn applied
+//	or revoked otherwise.
+func (s *Etcdv3Locker) withLease(key, val string, expire time.Duration, fn func(id etcd.LeaseID) (bool, error)) bool {
+	defer s.serialize(key)()
+	ttl := s.ttl(expire)
+	id, reused, err := s.obtain(key, ttl)
+	if err != nil {
+		return false
+	}
+	applied, err := fn(id)
+	if err != nil {
+		logrus.Warn("Write etcdv3 failed: ", err.Error())
+	}
+	if reused {
+		if applied && err == nil {
+			s.leases.Lock()
+			if e, ok := s.leases.entries[key]; ok && e.id == id {
+				e.val = val
+			}
+			s.leases.Unlock()
+			return true
+		}
+		return false
+	}
+	if applied && err == nil {
+		s.record(key, id, ttl, val)
+		return true
+	}
+	s.revoke(id)
+	return false
+}
+
+// Renew keeps the lease of key alive by KeepAliveOnce without writing, if current store wrote
+//	val with the same TTL lastly. The lock keeps the time it was written, and it's valid as
+//	long as the lease is alive.
+func (s *Etcdv3Locker) Renew(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
+	s.check()
+	key := s.key(lockKey)
+	defer s.serialize(key)()
+	e, ok := s.lease(key)
+	if !ok || e.ttl != s.ttl(expire) || e.val != val {
+		return false
+	}
+	return s.keepAlive(key, e)
+}
+
+// revokeAll revokes all leases recorded
+func (s *Etcdv3Locker) revokeAll() {
+	s.leases.Lock()
+	entries := s.leases.entries
+	s.leases.entries = nil
+	s.leases.Unlock()
+	now := time.Now()
+	for _, e := range entries {
+		if now.Before(e.deadline) {
+			s.revoke(e.id)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTL(t *testing.T) {
+	s := &Etcdv3Locker{defaultTTL: 60}
+	assert.Equal(t, int64(60), s.ttl(0))
+	assert.Equal(t, int64(2), s.ttl(1500*time.Millisecond))
+}
+
+func revoked(s *Etcdv3Locker, id etcd.LeaseID) bool {
+	resp, err := s.leaseApi.TimeToLive(context.Background(), id)
+	return err == nil && resp.TTL < 0
+}
+
+func TestLease(t *testing.T) {
+	store, _ := New([]string{"http://127.0.0.1:2379"}, WithTTL(5))
+	key := &distlock.LockKey{Namespace: "testns", Key: "lease"}
+	store.Delete(key)
+
+	assert.True(t, store.SetIfAbsent(key, "a", 2*time.Second))
+	id, ok := store.LeaseID(key)
+	assert.True(t, ok)
+
+	// reused when renewing
+	store.Keep(key, "b", 2*time.Second)
+	store.Set(key, "c", 2*time.Second)
+	assert.True(t, store.CompareAndSwap(key, "c", "d", 2*time.Second))
+	assert.False(t, store.SetIfAbsent(key, "e", 2*time.Second))
+	assert.Equal(t, "d", store.Get(key))
+	renewed, _ := store.LeaseID(key)
+	assert.Equal(t, id, renewed)
+
+	// replaced when the ttl changed
+	store.Set(key, "f", 0)
+	renewed, _ = store.LeaseID(key)
+	assert.NotEqual(t, id, renewed)
+	assert.True(t, revoked(store, id))
+	resp, err := store.leaseApi.TimeToLive(context.Background(), renewed)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), resp.GrantedTTL)
+
+	store.Delete(key)
+	_, ok = store.LeaseID(key)
+	assert.False(t, ok)
+	assert.True(t, revoked(store, renewed))
+
+	// revoked on close
+	assert.True(t, store.SetIfAbsent(key, "a", 10*time.Second))
+	store.Close()
+	other, _ := New([]string{"http://127.0.0.1:2379"})
+	assert.False(t, other.Exists(key))
+	other.Close()
+}
+
+// fakeLease grants increasing leases which never expire unless revoked
+type fakeLease struct {
+	etcd.Lease
+	mutex      sync.Mutex
+	last       etcd.LeaseID
+	revoked    map[etcd.LeaseID]bool
+	keepAlives int
+}
+
+func (l *fakeLease) Grant(ctx context.Context, ttl int64) (*etcd.LeaseGrantResponse, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.last++
+	return &etcd.LeaseGrantResponse{ID: l.last, TTL: ttl}, nil
+}
+
+func (l *fakeLease) Revoke(ctx context.Context, id etcd.LeaseID) (*etcd.LeaseRevokeResponse, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.revoked[id] = true
+	return &etcd.LeaseRevokeResponse{}, nil
+}
+
+func (l *fakeLease) KeepAliveOnce(ctx context.Context, id etcd.LeaseID) (*etcd.LeaseKeepAliveResponse, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.revoked[id] {
+		return nil, errors.New("requested lease not found")
+	}
+	l.keepAlives++
+	return &etcd.LeaseKeepAliveResponse{ID: id}, nil
+}
+
+func TestConcurrentLeases(t *testing.T) {
+	fake := &fakeLease{revoked: make(map[etcd.LeaseID]bool)}
+	s := &Etcdv3Locker{leaseApi: fake, defaultTTL: 60}
+	key := "/lock/testns/lease"
+
+	// the lease of the last write is the one alive
+	var written etcd.LeaseID
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		expire := time.Duration(i%3+1) * time.Second
+		delay := time.Duration(20-i) * time.Millisecond
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, s.withLease(key, "val", expire, func(id etcd.LeaseID) (bool, error) {
+				written = id
+				time.Sleep(delay)
+				return true, nil
+			}))
+		}()
+	}
+	wg.Wait()
+	id, ok := s.leases.entries[key]
+	assert.True(t, ok)
+	assert.Equal(t, written, id.id)
+	assert.False(t, fake.revoked[written])
+	assert.Empty(t, s.leases.writers)
+}
+
+func TestRenewWithoutWriting(t *testing.T) {
+	fake := &fakeLease{revoked: make(map[etcd.LeaseID]bool)}
+	// writing with the nil kvApi would panic
+	s := &Etcdv3Locker{leaseApi: fake, prefix: "/lock", defaultTTL: 60}
+	lockKey := &distlock.LockKey{Namespace: "testns", Key: "renew"}
+	assert.False(t, s.Renew(lockKey, "a", 2*time.Second))
+
+	var written etcd.LeaseID
+	assert.True(t, s.withLease(s.key(lockKey), "a", 2*time.Second, func(id etcd.LeaseID) (bool, error) {
+		written = id
+		return true, nil
+	}))
+	assert.True(t, s.Renew(lockKey, "a", 2*time.Second))
+	assert.True(t, s.Renew(lockKey, "a", 2*time.Second))
+	assert.Equal(t, 2, fake.keepAlives)
+	id, _ := s.LeaseID(lockKey)
+	assert.Equal(t, written, id)
+
+	// needs writing when the value or TTL changes
+	assert.False(t, s.Renew(lockKey, "b", 2*time.Second))
+	assert.False(t, s.Renew(lockKey, "a", 5*time.Second))
+	assert.Equal(t, 2, fake.keepAlives)
+
+	// or the lease is gone
+	fake.revoked[written] = true
+	assert.False(t, s.Renew(lockKey, "a", 2*time.Second))
+	_, ok := s.LeaseID(lockKey)
+	assert.False(t, ok)
+}
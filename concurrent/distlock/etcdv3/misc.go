@@ -5,12 +5,10 @@
 package etcdv3
 
 import (
-	"context"
 	"time"
 
 	etcd "github.com/coreos/etcd/clientv3"
 	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
-	"github.com/sirupsen/logrus"
 )
 
 func (s *Etcdv3Locker) check() {
@@ -27,13 +25,9 @@ func (s *Etcdv3Locker) key(lockKey *distlock.LockKey) string {
 	return s.prefix + "/" + lockKey.Namespace + "/" + lockKey.Key
 }
 
-func (s *Etcdv3Locker) lease(expire time.Duration) etcd.LeaseID {
-	resp, err := s.leaseApi.Grant(context.Background(), leaseTTL(expire))
-	if err != nil {
-		logrus.Warn("Create lease failed: ", err.Error())
-		return 0
-	}
-	return resp.ID
+// ValidateKey rejects keys which would break the layout of prefix/namespace/key
+func (s *Etcdv3Locker) ValidateKey(lockKey *distlock.LockKey) error {
+	return distlock.ValidatePathKey(lockKey)
 }
 
 // leaseTTL returns the seconds of TTL at least(seem to ceil())
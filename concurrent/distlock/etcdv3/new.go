@@ -6,11 +6,13 @@ package etcdv3
 
 import (
 	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
 )
 
 type etcdv3LockerConfig struct {
 	prefix, username, password string
 	ttl                        int
+	tls                        *distlock.TLSConfig
 }
 
 type Option func(cfg *etcdv3LockerConfig)
@@ -28,12 +30,20 @@ func WithPrefix(prefix string) Option {
 	}
 }
 
+// WithTTL specifies the TTL in seconds of leases when expiration isn't given, 60 by default
 func WithTTL(sec int) Option {
 	return func(cfg *etcdv3LockerConfig) {
 		cfg.ttl = sec
 	}
 }
 
+// WithTLS connects to the endpoints over TLS with the certificates specified
+func WithTLS(tls distlock.TLSConfig) Option {
+	return func(cfg *etcdv3LockerConfig) {
+		cfg.tls = &tls
+	}
+}
+
 func New(addrs []string, opts ...Option) (*Etcdv3Locker, error) {
 	lockerConfig := &etcdv3LockerConfig{}
 	for _, fn := range opts {
@@ -46,6 +56,13 @@ func New(addrs []string, opts ...Option) (*Etcdv3Locker, error) {
 		cfg.Username = lockerConfig.username
 		cfg.Password = lockerConfig.password
 	}
+	if lockerConfig.tls != nil {
+		tlsConfig, err := lockerConfig.tls.Build()
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = tlsConfig
+	}
 	if lockerConfig.prefix == "" {
 		lockerConfig.prefix = "/lock"
 	}
@@ -60,9 +77,10 @@ func New(addrs []string, opts ...Option) (*Etcdv3Locker, error) {
 		return nil, err
 	}
 	return &Etcdv3Locker{
-		client:   c,
-		kvApi:    etcd.NewKV(c),
-		leaseApi: etcd.NewLease(c),
-		prefix:   lockerConfig.prefix,
+		client:     c,
+		kvApi:      etcd.NewKV(c),
+		leaseApi:   etcd.NewLease(c),
+		prefix:     lockerConfig.prefix,
+		defaultTTL: int64(lockerConfig.ttl),
 	}, nil
 }
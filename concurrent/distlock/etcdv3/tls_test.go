@@ -0,0 +1,34 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package etcdv3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLS(t *testing.T) {
+	f := storetest.NewTLSFixture(t)
+	// the stand-in only verifies the client and doesn't speak gRPC
+	addr, clients := f.Serve(t, nil)
+
+	locker, err := New([]string{"https://" + addr}, WithTLS(f.Config()))
+	assert.NoError(t, err)
+	locker.Ping()
+	select {
+	case name := <-clients:
+		assert.Equal(t, "client", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Client certificate isn't presented")
+	}
+	locker.Close()
+
+	_, err = New([]string{"https://" + addr}, WithTLS(distlock.TLSConfig{CAFile: f.Dir + "/absent.pem"}))
+	assert.Error(t, err)
+}
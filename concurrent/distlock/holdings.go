@@ -0,0 +1,116 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"sync"
+	"time"
+)
+
+// Holdings keeps the locks held by a native lock of backend along with their reentrant
+//	counts, like the zookeeper sequential lock and the etcdv3 concurrency lock.
+//	The value of a holding is the handle of backend, eg. the node or session.
+type Holdings struct {
+	mutex    sync.Mutex
+	owner    string
+	reentry  bool
+	holdings map[string]*holding
+}
+
+type holding struct {
+	value interface{}
+	count int
+	since time.Time
+}
+
+// NewHoldings returns empty holdings of owner, which can be reentered if reentry is true
+func NewHoldings(owner string, reentry bool) *Holdings {
+	return &Holdings{
+		owner:    owner,
+		reentry:  reentry,
+		holdings: make(map[string]*holding),
+	}
+}
+
+// Enter increases the count and returns true if key is held and reentry is allowed.
+//	It returns an ErrHeld if key is held but can't be reentered, so a lock doesn't
+//	wait for itself, or false if key isn't held.
+func (h *Holdings) Enter(key string) (bool, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	holding, ok := h.holdings[key]
+	if !ok {
+		return false, nil
+	}
+	if !h.reentry {
+		return false, &ErrHeld{LockInfo: LockInfo{Owner: h.owner, Locked: holding.since}}
+	}
+	holding.count++
+	return true, nil
+}
+
+// Hold records key as acquired with value of backend
+func (h *Holdings) Hold(key string, value interface{}) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.holdings[key] = &holding{
+		value: value,
+		count: 1,
+		since: time.Now(),
+	}
+}
+
+// Get returns the value of key held
+func (h *Holdings) Get(key string) (interface{}, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if holding, ok := h.holdings[key]; ok {
+		return holding.value, true
+	}
+	return nil, false
+}
+
+// Leave decreases the count of key, and returns the value with last=true when it reaches
+//	zero and key is removed, which should be released in backend then.
+//	held is false if key isn't held.
+func (h *Holdings) Leave(key string) (value interface{}, held bool, last bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	holding, ok := h.holdings[key]
+	if !ok {
+		return nil, false, false
+	}
+	holding.count--
+	if holding.count > 0 {
+		return holding.value, true, false
+	}
+	delete(h.holdings, key)
+	return holding.value, true, true
+}
+
+// Remove forgets key no matter how many times it's held, eg. when it's lost
+func (h *Holdings) Remove(key string) (interface{}, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	holding, ok := h.holdings[key]
+	if !ok {
+		return nil, false
+	}
+	delete(h.holdings, key)
+	return holding.value, true
+}
+
+// Clear removes all holdings and returns their values by keys, eg. when closing
+func (h *Holdings) Clear() map[string]interface{} {
+	h.mutex.Lock()
+	holdings := h.holdings
+	h.holdings = make(map[string]*holding)
+	h.mutex.Unlock()
+	values := make(map[string]interface{}, len(holdings))
+	for key, holding := range holdings {
+		values[key] = holding.value
+	}
+	return values
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jasonjoo2010/enhanced-utils/strutils"
@@ -12,6 +13,7 @@ import (
 )
 
 // lock value format: {uuid}|{locked timestamp in millisecond}
+//	or {uuid}|{locked timestamp in millisecond}|{ttl in millisecond}|{metadata} if customized
 
 const TRY_INTERVAL time.Duration = 10 * time.Millisecond
 
@@ -23,6 +25,16 @@ type DistLockImpl struct {
 	uuid      string
 	expire    time.Duration
 	reentry   bool
+	policy    AvailabilityPolicy
+	encoder   KeyEncoder
+
+	// local queue of contending goroutines
+	queueMutex sync.Mutex
+	slots      map[string]*slot
+
+	// handlers of lost locks, guarded by queueMutex
+	lostHandlers []func(lockKey *LockKey)
+	cancelLost   func()
 }
 
 // NewMutex returns a non-reentry distributed lock
@@ -54,116 +66,428 @@ func NewReentry(namespace string, expire time.Duration, store Store) DistLock {
 }
 
 func parseLockData(data string) (uuid string, created int64) {
-	if len(data) < 1 {
+	info := parseLockInfo(data)
+	if info == nil {
 		return
 	}
+	return info.Owner, info.Locked.UnixNano() / 1e6
+}
 
-	pos := strings.IndexByte(data, '|')
-	if pos < 0 {
-		return
+// parseLockInfo returns nil if the lock data is malformed
+func parseLockInfo(data string) *LockInfo {
+	parts := strings.SplitN(data, "|", 4)
+	if (len(parts) != 2 && len(parts) != 4) || parts[0] == "" {
+		return nil
 	}
-
-	uuid = data[:pos]
-	created, err := strconv.ParseInt(data[pos+1:], 10, 64)
+	created, err := strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		created = 0
-		uuid = ""
-		return
+		return nil
 	}
-	return
+	info := &LockInfo{
+		Owner:  parts[0],
+		Locked: time.Unix(0, created*1e6),
+	}
+	if len(parts) == 4 {
+		ttl, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || ttl <= 0 {
+			return nil
+		}
+		info.TTL = time.Duration(ttl) * time.Millisecond
+		info.Metadata = parts[3]
+	}
+	return info
 }
 
-func (l *DistLockImpl) key(target interface{}) *LockKey {
+// key encodes the target and validates it if the store is a KeyValidator
+func (l *DistLockImpl) key(target interface{}) (*LockKey, error) {
 	ns := l.namespace
 	if ns == "" {
 		ns = "distributed-lock"
 	}
-	return &LockKey{
-		Namespace: ns,
-		Key:       fmt.Sprintf("%v", target),
-	}
+	return NewLockKey(l.store, l.encoder, ns, target)
+}
+
+// SetKeyEncoder changes how targets are encoded into keys, DefaultKeyEncoder by default.
+//	It should be the same for all owners of a namespace.
+func (l *DistLockImpl) SetKeyEncoder(encoder KeyEncoder) {
+	l.encoder = encoder
+}
+
+// SetAvailabilityPolicy decides what to do when the store is unavailable, FailClosed by default.
+//	Wrap the store by {NewBreaker} to detect a dead backend quickly.
+func (l *DistLockImpl) SetAvailabilityPolicy(policy AvailabilityPolicy) {
+	l.policy = policy
+}
+
+// OwnerID returns the identity of current owner written in lock data
+func (l *DistLockImpl) OwnerID() string {
+	return l.uuid
 }
 
 func (l *DistLockImpl) Close() {
+	l.queueMutex.Lock()
+	if l.cancelLost != nil {
+		l.cancelLost()
+		l.cancelLost = nil
+	}
+	l.queueMutex.Unlock()
 	l.store.Close()
 }
 
 func (l *DistLockImpl) Keep(target interface{}) {
-	lockKey := l.key(target)
-	valid, myself := l.verify(lockKey)
-	if valid && myself {
-		val := fmt.Sprintf("%s|%d", l.uuid, time.Now().UnixNano()/1e6)
-		l.store.Set(lockKey, val, l.expire)
+	l.Renew(target)
+}
+
+// KeepWith works like {Keep} but accepts options, e.g. {WithTTL} to change the expiration
+func (l *DistLockImpl) KeepWith(target interface{}, opts ...LockOption) {
+	l.Renew(target, opts...)
+}
+
+// Renew works like {KeepWith} but returns ErrNotOwner or ErrStoreUnavailable when failed
+func (l *DistLockImpl) Renew(target interface{}, opts ...LockOption) error {
+	lockKey, err := l.key(target)
+	if err != nil {
+		return err
+	}
+	o := newLockOptions(opts)
+	if err := l.checkMetadata(o); err != nil {
+		return err
+	}
+	val := l.store.Get(lockKey)
+	if valid, myself := l.verifyData(val); !valid || !myself {
+		err = l.check(val, ErrNotOwner)
+		if l.localRenew(lockKey) {
+			return nil
+		}
+		if errors.Is(err, ErrStoreUnavailable) && l.policy == FailOpen {
+			log.Warnf("Regard lock of %v as renewed: %v", target, err)
+			return nil
+		}
+		return err
+	}
+	o = l.inherit(o, val)
+	// extend it without writing if nothing but the time changes
+	renewer, ok := l.store.(Renewer)
+	if !ok || l.lockDataAt(l.uuid, o, parseLockInfo(val).Locked) != val || !renewer.Renew(lockKey, val, o.ttl) {
+		l.store.Set(lockKey, l.lockData(l.uuid, o), o.ttl)
 	}
+	l.renewed(lockKey.String(), o.ttl)
+	return nil
 }
 
 func (l *DistLockImpl) Lock(target interface{}, wait time.Duration) error {
-	timer := time.NewTimer(wait)
+	if err := l.Acquire(target, wait); err != nil {
+		return LockFailed
+	}
+	return nil
+}
+
+// LockWith works like {Lock} but accepts options, and it waits only if {WithWait} is specified.
+//	The error is the one of {TryAcquire}, where errors.Is(err, LockFailed) is true if the lock
+//	is held by others.
+func (l *DistLockImpl) LockWith(target interface{}, opts ...LockOption) error {
+	return l.TryAcquire(target, opts...)
+}
+
+// Acquire works like {Lock} but returns ErrTimeout or ErrStoreUnavailable when failed.
+//	{WithWait} in options is ignored.
+func (l *DistLockImpl) Acquire(target interface{}, wait time.Duration, opts ...LockOption) error {
+	return l.lock(target, newLockOptions(opts), time.Now().Add(wait))
+}
+
+// lock acquires the lock until deadline, or only once if deadline is zero
+func (l *DistLockImpl) lock(target interface{}, o *lockOptions, deadline time.Time) error {
+	lockKey, err := l.key(target)
+	if err != nil {
+		return err
+	}
+	if err := l.checkMetadata(o); err != nil {
+		return err
+	}
+	key := lockKey.String()
 	for {
-		succ := l.TryLock(target)
-		if succ {
-			timer.Stop()
+		reenter, err := l.enter(key, deadline)
+		if err != nil {
+			return err
+		}
+		if !reenter {
+			break
+		}
+		val := l.store.Get(lockKey)
+		if valid, myself := l.verifyData(val); valid && myself {
+			o = l.inherit(o, val)
+			l.store.Set(lockKey, l.lockData(l.uuid, o), o.ttl)
+			l.renewed(key, o.ttl)
 			return nil
 		}
-		select {
-		case <-timer.C:
+		// transferred, expired or released by others
+		l.released(key)
+	}
+	if deadline.IsZero() {
+		err = l.acquire(target, lockKey, o)
+	} else {
+		err = l.poll(target, lockKey, o, deadline)
+	}
+	l.leave(key, err == nil, l.inherit(o, "").ttl)
+	return err
+}
+
+// poll tries to acquire the lock from store until deadline
+func (l *DistLockImpl) poll(target interface{}, lockKey *LockKey, o *lockOptions, deadline time.Time) error {
+	for {
+		err := l.acquire(target, lockKey, o)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, ErrStoreUnavailable) && l.policy == FailClosed {
+			return err
+		}
+		if !time.Now().Before(deadline) {
 			// timeout
-			return LockFailed
-		default:
-			time.Sleep(TRY_INTERVAL)
+			if errors.Is(err, ErrStoreUnavailable) {
+				return err
+			}
+			return ErrTimeout
+		}
+		time.Sleep(o.retry)
+	}
+}
+
+// lockData returns the lock data of owner, in the legacy format if not customized
+func (l *DistLockImpl) lockData(owner string, o *lockOptions) string {
+	return l.lockDataAt(owner, o, time.Now())
+}
+
+// lockDataAt returns the lock data written at the specified time
+func (l *DistLockImpl) lockDataAt(owner string, o *lockOptions, at time.Time) string {
+	millis := at.UnixNano() / 1e6
+	if o.ttl == l.expire && o.metadata == "" {
+		return fmt.Sprintf("%s|%d", owner, millis)
+	}
+	return fmt.Sprintf("%s|%d|%d|%s", owner, millis, o.ttl/time.Millisecond, o.metadata)
+}
+
+// held returns an ErrHeld describing the lock data
+func (l *DistLockImpl) held(val string) error {
+	err := &ErrHeld{}
+	info := parseLockInfo(val)
+	if info == nil {
+		return err
+	}
+	err.LockInfo = *info
+	if _, ok := l.store.(Renewer); ok {
+		return err
+	}
+	err.Remaining = time.Until(info.Locked.Add(l.ttl(info)))
+	if err.Remaining < 0 {
+		err.Remaining = 0
+	}
+	return err
+}
+
+// check returns ErrStoreUnavailable if nothing was read due to an unreachable backend
+//	or the specified error
+func (l *DistLockImpl) check(val string, err error) error {
+	if val != "" {
+		return err
+	}
+	if pinger, ok := l.store.(Pinger); ok {
+		if pingErr := pinger.Ping(); pingErr != nil {
+			return unavailable(pingErr)
 		}
 	}
+	return err
 }
 
 // verify an existed lock data structure and return true when valid
 //	valid indicates whether the lock is valid
 //	myself indicates whether the owner is myself
 func (l *DistLockImpl) verify(lockKey *LockKey) (valid bool, myself bool) {
-	val := l.store.Get(lockKey)
 	// XXX: Pay attention to the phantom reads of redis (double reading could solve it, but confirmed to do that)
-	uuid, created := parseLockData(val)
-	if uuid == "" {
+	return l.verifyData(l.store.Get(lockKey))
+}
+
+// verifyData verifies the lock data read
+func (l *DistLockImpl) verifyData(val string) (valid bool, myself bool) {
+	info := parseLockInfo(val)
+	if info == nil {
 		return
 	}
-	diff := time.Duration(time.Now().UnixNano()-created*1e6) * time.Nanosecond
-	if diff > l.expire {
+	// locks renewed by a Renewer keep the time written and vanish when expired
+	if _, ok := l.store.(Renewer); !ok && time.Since(info.Locked) > l.ttl(info) {
 		return
 	}
-	myself = uuid == l.uuid
+	myself = info.Owner == l.uuid
 	valid = true
 	return
 }
 
+// Inspect returns the information of a valid lock, or nil if it's free
+func (l *DistLockImpl) Inspect(target interface{}) (*LockInfo, error) {
+	lockKey, err := l.key(target)
+	if err != nil {
+		return nil, err
+	}
+	val := l.store.Get(lockKey)
+	if valid, _ := l.verifyData(val); !valid {
+		return nil, l.check(val, nil)
+	}
+	return parseLockInfo(val), nil
+}
+
 func (l *DistLockImpl) TryLock(target interface{}) bool {
-	lockKey := l.key(target)
+	return l.TryAcquire(target) == nil
+}
+
+// TryLockWith works like {TryLock} but accepts options, e.g. {WithTTL} or {WithWait}
+func (l *DistLockImpl) TryLockWith(target interface{}, opts ...LockOption) bool {
+	return l.TryAcquire(target, opts...) == nil
+}
+
+// TryAcquire works like {TryLockWith} but returns ErrHeld, ErrTimeout or ErrStoreUnavailable when failed
+func (l *DistLockImpl) TryAcquire(target interface{}, opts ...LockOption) error {
+	o := newLockOptions(opts)
+	deadline := time.Time{}
+	if o.wait > 0 {
+		deadline = time.Now().Add(o.wait)
+	}
+	return l.lock(target, o, deadline)
+}
+
+// acquire tries to acquire the lock from store once and applies the availability policy
+func (l *DistLockImpl) acquire(target interface{}, lockKey *LockKey, o *lockOptions) error {
+	err := l.tryAcquire(target, lockKey, o)
+	if !errors.Is(err, ErrStoreUnavailable) {
+		return err
+	}
+	switch l.policy {
+	case FailOpen:
+		log.Warnf("Regard %v as locked: %v", target, err)
+		return nil
+	case FailLocal:
+		log.Warnf("Lock %v locally: %v", target, err)
+		return l.localAcquire(lockKey, l.inherit(o, "").ttl)
+	}
+	return err
+}
+
+func (l *DistLockImpl) tryAcquire(target interface{}, lockKey *LockKey, o *lockOptions) error {
 	if l.store.Exists(lockKey) {
 		// verify the lock
-		if valid, myself := l.verify(lockKey); valid {
+		val := l.store.Get(lockKey)
+		if valid, myself := l.verifyData(val); valid {
 			// valid lock
 			if l.reentry && myself {
 				// allow reentry, check whether already locked and update it
-				val := fmt.Sprintf("%s|%d", l.uuid, time.Now().UnixNano()/1e6)
-				l.store.Set(lockKey, val, l.expire)
-				return true
+				o = l.inherit(o, val)
+				l.store.Set(lockKey, l.lockData(l.uuid, o), o.ttl)
+				return nil
 			}
-			return false
+			return l.held(val)
 		}
 		log.Warnf("Force release an invalid lock for %v", target)
 		l.store.Delete(lockKey)
 	}
 	// try to lock
-	val := fmt.Sprintf("%s|%d", l.uuid, time.Now().UnixNano()/1e6)
-	succ := l.store.SetIfAbsent(lockKey, val, l.expire)
-	return succ
+	o = l.inherit(o, "")
+	if l.store.SetIfAbsent(lockKey, l.lockData(l.uuid, o), o.ttl) {
+		return nil
+	}
+	val := l.store.Get(lockKey)
+	return l.check(val, l.held(val))
 }
 
 func (l *DistLockImpl) UnLock(target interface{}) bool {
-	lockKey := l.key(target)
-	uuid, _ := parseLockData(l.store.Get(lockKey))
+	return l.Release(target) == nil
+}
+
+// Release works like {UnLock} but returns ErrNotOwner or ErrStoreUnavailable when failed,
+//	then the lock is still regarded as held by local goroutines until it expires.
+func (l *DistLockImpl) Release(target interface{}) error {
+	lockKey, err := l.key(target)
+	if err != nil {
+		return err
+	}
+	// the local slot is kept unless released
+	key := lockKey.String()
+	val := l.store.Get(lockKey)
+	uuid, _ := parseLockData(val)
 	if uuid != l.uuid {
 		// only the lock who locked it can unlock
-		return false
+		err = l.check(val, ErrNotOwner)
+		if l.localRelease(lockKey) {
+			l.released(key)
+			return nil
+		}
+		if errors.Is(err, ErrStoreUnavailable) && l.policy == FailOpen {
+			log.Warnf("Regard %v as unlocked: %v", target, err)
+			l.released(key)
+			return nil
+		}
+		return err
 	}
 	l.store.Delete(lockKey)
+	l.released(key)
+	return nil
+}
+
+// Transfer hands a lock held by myself over to the owner identified by {newOwnerID}
+//	atomically without a window that it's free, and returns true for success.
+//	The receiving side should invoke {Adopt} afterwards to take it over.
+func (l *DistLockImpl) Transfer(target interface{}, newOwnerID string) bool {
+	lockKey, err := l.key(target)
+	if err != nil {
+		log.Warnf("Failed to transfer lock for %v: %v", target, err)
+		return false
+	}
+	atomicStore, ok := l.store.(AtomicStore)
+	if !ok {
+		log.Warnf("Store doesn't support transferring lock for %v", target)
+		return false
+	}
+	val := l.store.Get(lockKey)
+	if valid, myself := l.verifyData(val); !valid || !myself {
+		return false
+	}
+	// the ttl and metadata are kept
+	o := l.inherit(&lockOptions{}, val)
+	if !atomicStore.CompareAndSwap(lockKey, val, l.lockData(newOwnerID, o), o.ttl) {
+		return false
+	}
+	l.released(lockKey.String())
 	return true
 }
+
+// Adopt takes over a lock transferred to myself, renews it and returns true for success.
+//	It's held locally the same as the ones acquired, and fails if a local goroutine is acquiring it.
+func (l *DistLockImpl) Adopt(target interface{}) bool {
+	lockKey, err := l.key(target)
+	if err != nil {
+		log.Warnf("Failed to adopt lock for %v: %v", target, err)
+		return false
+	}
+	atomicStore, ok := l.store.(AtomicStore)
+	if !ok {
+		log.Warnf("Store doesn't support adopting lock for %v", target)
+		return false
+	}
+	val := l.store.Get(lockKey)
+	if valid, myself := l.verifyData(val); !valid || !myself {
+		return false
+	}
+	// registered locally like the ones acquired
+	key := lockKey.String()
+	reenter, err := l.enter(key, time.Time{})
+	if err != nil {
+		log.Warnf("Failed to adopt lock for %v: %v", target, err)
+		return false
+	}
+	o := l.inherit(&lockOptions{}, val)
+	adopted := atomicStore.CompareAndSwap(lockKey, val, l.lockData(l.uuid, o), o.ttl)
+	if !reenter {
+		l.leave(key, adopted, o.ttl)
+	} else if adopted {
+		l.renewed(key, o.ttl)
+	}
+	return adopted
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+// Command breakergen generates the combinations of facets of the circuit breaker in distlock,
+//	so the breaker implements exactly the optional interfaces which the wrapped store does.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// capabilities are the optional interfaces of stores and the facets exposing them
+var capabilities = []struct {
+	iface, facet string
+}{
+	{"AtomicStore", "breakerAtomic"},
+	{"WatchStore", "breakerWatcher"},
+	{"LossNotifier", "breakerNotifier"},
+	{"Lister", "breakerLister"},
+	{"KeyValidator", "breakerValidator"},
+	{"ValueLimiter", "breakerLimiter"},
+	{"Renewer", "breakerRenewer"},
+}
+
+func main() {
+	output := "breaker_gen.go"
+	if len(os.Args) > 1 {
+		output = os.Args[1]
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "// Copyright 2020 The enhanced-utils Authors. All rights reserved.")
+	fmt.Fprintln(buf, "// Use of this source code is governed by BSD")
+	fmt.Fprintln(buf, "// license that can be found in the LICENSE file.")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "// Code generated by internal/breakergen. DO NOT EDIT.")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "package distlock")
+	fmt.Fprintln(buf)
+
+	fmt.Fprintln(buf, "// capabilities returns the index of {breakers} whose bits mark the optional interfaces of store")
+	fmt.Fprintln(buf, "func capabilities(store Store) (index int) {")
+	for i, c := range capabilities {
+		fmt.Fprintf(buf, "if _, ok := store.(%s); ok {\nindex |= %d\n}\n", c.iface, 1<<i)
+	}
+	fmt.Fprintln(buf, "return\n}")
+	fmt.Fprintln(buf)
+
+	fmt.Fprintln(buf, "// breakers compose the breaker with the facets marked by the bits of index")
+	fmt.Fprintln(buf, "var breakers = [...]func(b *breakerStore) Breaker{")
+	for index := 0; index < 1<<len(capabilities); index++ {
+		if index == 0 {
+			fmt.Fprintln(buf, "func(b *breakerStore) Breaker { return b },")
+			continue
+		}
+		fields, values := "*breakerStore\n", "b"
+		for i, c := range capabilities {
+			if index&(1<<i) != 0 {
+				fields += c.facet + "\n"
+				values += ", " + c.facet + "{b}"
+			}
+		}
+		fmt.Fprintf(buf, "func(b *breakerStore) Breaker {\nreturn struct {\n%s}{%s}\n},\n", fields, values)
+	}
+	fmt.Fprintln(buf, "}")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+// OnLost registers a handler called when a lock held by current instance is lost without
+//	being released, eg. along with an expired zookeeper session. The lock is regarded as
+//	released locally before that. It returns false if the store can't tell it.
+func (l *DistLockImpl) OnLost(handler func(lockKey *LockKey)) bool {
+	notifier, ok := l.store.(LossNotifier)
+	if !ok {
+		return false
+	}
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	l.lostHandlers = append(l.lostHandlers, handler)
+	if l.cancelLost == nil {
+		l.cancelLost = notifier.OnLost(l.lost)
+	}
+	return true
+}
+
+func (l *DistLockImpl) lost(lockKey *LockKey) {
+	key := lockKey.String()
+	l.queueMutex.Lock()
+	s, ok := l.slots[key]
+	if !ok || !s.held {
+		// not mine
+		l.queueMutex.Unlock()
+		return
+	}
+	s.held = false
+	s.notify()
+	l.cleanup(key, s)
+	handlers := l.lostHandlers
+	l.queueMutex.Unlock()
+	for _, handler := range handlers {
+		handler(lockKey)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package migrate
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+)
+
+// ErrUnknownScheme indicates no opener is registered for the scheme of store URL
+var ErrUnknownScheme = errors.New("Unknown scheme of store")
+
+// Opener opens a store with the part after "<scheme>://" of store URL
+type Opener func(addr string) (distlock.Store, error)
+
+func open(url string, openers map[string]Opener) (distlock.Store, error) {
+	pos := strings.Index(url, "://")
+	if pos < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownScheme, url)
+	}
+	opener, ok := openers[url[:pos]]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownScheme, url[:pos])
+	}
+	s, err := opener(url[pos+3:])
+	if err == nil && s == nil {
+		err = fmt.Errorf("Can't open store %s", url)
+	}
+	return s, err
+}
+
+// Run is the body of a migration command, whose backends are registered by scheme because
+//	they're separated modules, eg.
+//	func main() {
+//		err := migrate.Run(os.Args[1:], map[string]migrate.Opener{
+//			"etcdv2": func(addr string) (distlock.Store, error) {
+//				return etcdv2.New(strings.Split(addr, ",")), nil
+//			},
+//			"etcdv3": func(addr string) (distlock.Store, error) {
+//				return etcdv3.New(strings.Split(addr, ","))
+//			},
+//		}, os.Stdout)
+//	}
+//	And copy locks by:
+//	migrate -from etcdv2://http://127.0.0.1:2379 -to etcdv3://http://127.0.0.1:2379 -namespaces ns1,ns2
+//	The command of all backends is in cmd/migrate. Locks never expiring are listed and fail
+//	the run with ErrPersistentLocks after the others are copied.
+func Run(args []string, openers map[string]Opener, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	fromURL := flags.String("from", "", "URL of the store to copy locks from, <scheme>://<address>")
+	toURL := flags.String("to", "", "URL of the store to copy locks to, <scheme>://<address>")
+	namespaces := flags.String("namespaces", "", "comma separated namespaces to copy")
+	dryRun := flags.Bool("dry-run", false, "list the locks only")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *fromURL == "" || *namespaces == "" || (*toURL == "" && !*dryRun) {
+		flags.Usage()
+		return errors.New("-from, -to and -namespaces are required")
+	}
+
+	from, err := open(*fromURL, openers)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	if *dryRun {
+		for _, namespace := range strings.Split(*namespaces, ",") {
+			entries, err := list(from, namespace)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				fmt.Fprintf(out, "%s\t%s\t%s\t%v\n", namespace, e.LockKey.Key, e.Value, e.TTL)
+			}
+		}
+		return nil
+	}
+	to, err := open(*toURL, openers)
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+	persistent := 0
+	for _, namespace := range strings.Split(*namespaces, ",") {
+		stats, err := Copy(from, to, namespace)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s: %d listed, %d copied, %d skipped, %d never expiring\n",
+			namespace, stats.Listed, stats.Copied, stats.Skipped, stats.Persistent)
+		for _, key := range stats.PersistentKeys {
+			fmt.Fprintf(out, "%s\t%s\tnever expires, copy it by hand\n", namespace, key.Key)
+		}
+		persistent += stats.Persistent
+	}
+	if persistent > 0 {
+		return fmt.Errorf("%w: %d", ErrPersistentLocks, persistent)
+	}
+	return nil
+}
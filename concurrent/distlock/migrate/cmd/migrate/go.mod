@@ -0,0 +1,26 @@
+module github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/migrate/cmd/migrate
+
+go 1.14
+
+require (
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/jasonjoo2010/enhanced-utils v0.0.2
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/database v0.0.0
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/etcdv2 v0.0.0
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/etcdv3 v0.0.0
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/redis v0.0.0
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/zookeeper v0.0.0
+	github.com/lib/pq v1.7.0
+	github.com/mattn/go-sqlite3 v1.14.0
+)
+
+// built along with the backends in this repository
+replace (
+	github.com/coreos/bbolt v1.3.4 => go.etcd.io/bbolt v1.3.4
+	github.com/jasonjoo2010/enhanced-utils => ../../../../..
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/database => ../../../database
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/etcdv2 => ../../../etcdv2
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/etcdv3 => ../../../etcdv3
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/redis => ../../../redis
+	github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/zookeeper => ../../../zookeeper
+)
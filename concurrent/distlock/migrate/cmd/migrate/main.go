@@ -0,0 +1,73 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+// Command migrate copies locks between stores of all backends, see migrate.Run. Stores are
+//	specified by URLs of schemes:
+//	etcdv2://http://127.0.0.1:2379,http://127.0.0.2:2379
+//	etcdv3://http://127.0.0.1:2379,http://127.0.0.2:2379
+//	redis://127.0.0.1:6379,127.0.0.2:6379
+//	zookeeper://127.0.0.1:2181,127.0.0.2:2181
+//	mysql://<dsn>, postgres://<dsn> or sqlite3://<file> of the lock table
+//	eg.
+//	migrate -from etcdv2://http://127.0.0.1:2379 -to etcdv3://http://127.0.0.1:2379 -namespaces ns1,ns2
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/database"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/etcdv2"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/etcdv3"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/migrate"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/redis"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/zookeeper"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func databaseOpener(driver string, dialect database.Dialect) migrate.Opener {
+	return func(addr string) (distlock.Store, error) {
+		db, err := sql.Open(driver, addr)
+		if err != nil {
+			return nil, err
+		}
+		s, err := database.Open(db, database.WithDialect(dialect))
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+var openers = map[string]migrate.Opener{
+	"etcdv2": func(addr string) (distlock.Store, error) {
+		return etcdv2.New(strings.Split(addr, ",")), nil
+	},
+	"etcdv3": func(addr string) (distlock.Store, error) {
+		return etcdv3.New(strings.Split(addr, ","))
+	},
+	"redis": func(addr string) (distlock.Store, error) {
+		return redis.NewWithOptions(strings.Split(addr, ","))
+	},
+	"zookeeper": func(addr string) (distlock.Store, error) {
+		// namespaces listed are initialized lazily
+		return zookeeper.Open("distributed-lock", 60000, strings.Split(addr, ","))
+	},
+	"mysql":    databaseOpener("mysql", database.MySQL),
+	"postgres": databaseOpener("postgres", database.PostgreSQL),
+	"sqlite3":  databaseOpener("sqlite3", database.SQLite),
+}
+
+func main() {
+	if err := migrate.Run(os.Args[1:], openers, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
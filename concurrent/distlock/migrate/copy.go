@@ -0,0 +1,65 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package migrate
+
+import (
+	"errors"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrPersistentLocks indicates some locks never expiring weren't copied by {Run}
+var ErrPersistentLocks = errors.New("Locks never expiring aren't copied")
+
+// Stats counts the locks handled by {Copy}
+type Stats struct {
+	Listed int
+	Copied int
+	// Skipped counts the locks existing in the target store already
+	Skipped int
+	// Persistent counts the locks never expiring, which aren't copied
+	Persistent int
+	// PersistentKeys are the keys of those locks, to be copied by hand
+	PersistentKeys []distlock.LockKey
+}
+
+func list(s distlock.Store, namespace string) ([]distlock.Entry, error) {
+	lister, ok := s.(distlock.Lister)
+	if !ok {
+		return nil, distlock.ErrNotLister
+	}
+	return lister.List(namespace)
+}
+
+// Copy writes the locks alive in namespaces of {from} to {to} with their remaining TTL.
+//	Locks already existing in {to} are skipped, whatever their values are.
+//	Locks never expiring are left to be handled by hand, because a zero expiration means
+//	differently among stores, eg. the default TTL of etcdv3 or immediate expiration of mock.
+func Copy(from, to distlock.Store, namespaces ...string) (Stats, error) {
+	stats := Stats{}
+	for _, namespace := range namespaces {
+		entries, err := list(from, namespace)
+		if err != nil {
+			return stats, err
+		}
+		stats.Listed += len(entries)
+		for i := range entries {
+			e := &entries[i]
+			if e.TTL == 0 {
+				logrus.Warn("Lock ", e.LockKey.String(), " never expires and isn't copied")
+				stats.Persistent++
+				stats.PersistentKeys = append(stats.PersistentKeys, e.LockKey)
+				continue
+			}
+			if to.SetIfAbsent(&e.LockKey, e.Value, e.TTL) {
+				stats.Copied++
+			} else {
+				stats.Skipped++
+			}
+		}
+	}
+	return stats, nil
+}
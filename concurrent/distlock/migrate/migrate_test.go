@@ -0,0 +1,175 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/mock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// plainStore hides the Lister of mock
+type plainStore struct {
+	distlock.AtomicStore
+}
+
+// persistentStore lists the locks of mock as never expiring
+type persistentStore struct {
+	*mock.MockLocker
+}
+
+func (s persistentStore) List(namespace string) ([]distlock.Entry, error) {
+	entries, err := s.MockLocker.List(namespace)
+	for i := range entries {
+		entries[i].TTL = 0
+	}
+	return entries, err
+}
+
+func TestMigratingStore(t *testing.T) {
+	storetest.DoTest(t, NewMigratingStore(mock.New(), mock.New()))
+}
+
+func TestDualWrite(t *testing.T) {
+	from, to := mock.New(), mock.New()
+	s := NewMigratingStore(from, to)
+	key := &distlock.LockKey{Namespace: "testns", Key: "a"}
+
+	lock := distlock.NewMutex("testns", 2*time.Second, s)
+	assert.True(t, lock.TryLock("a"))
+	assert.True(t, from.Exists(key))
+	assert.Equal(t, from.Get(key), to.Get(key))
+	assert.True(t, lock.UnLock("a"))
+	assert.False(t, from.Exists(key))
+	assert.False(t, to.Exists(key))
+
+	// read from new store if absent in old one
+	to.Set(key, "v", 2*time.Second)
+	assert.True(t, s.Exists(key))
+	assert.Equal(t, "v", s.Get(key))
+	to.Delete(key)
+
+	// held in new store by an instance migrated already
+	migrated := distlock.NewMutex("testns", 2*time.Second, to)
+	assert.True(t, migrated.TryLock("a"))
+	assert.False(t, lock.TryLock("a"))
+	assert.False(t, from.Exists(key))
+	assert.True(t, migrated.UnLock("a"))
+
+	// a lock acquired before migrating is mirrored when renewed
+	from.Set(key, "old", 2*time.Second)
+	assert.True(t, s.CompareAndSwap(key, "old", "new", 2*time.Second))
+	assert.Equal(t, "new", to.Get(key))
+	to.Set(key, "other", 2*time.Second)
+	assert.False(t, s.CompareAndSwap(key, "new", "newer", 2*time.Second))
+	assert.Equal(t, "new", from.Get(key))
+
+	// never overwrite the one held by others in the new store when renewing
+	s.Keep(key, "newer", 2*time.Second)
+	assert.Equal(t, "newer", from.Get(key))
+	assert.Equal(t, "other", to.Get(key))
+	s.Set(key, "newest", 2*time.Second)
+	assert.Equal(t, "other", to.Get(key))
+	to.Set(key, "newest", 2*time.Second)
+	s.Keep(key, "renewed", 2*time.Second)
+	assert.Equal(t, "renewed", to.Get(key))
+	s.Delete(key)
+	assert.False(t, s.Exists(key))
+
+	// not copied yet
+	from.Set(key, "old", 2*time.Second)
+	s.Keep(key, "old", 2*time.Second)
+	assert.Equal(t, "old", to.Get(key))
+	s.Delete(key)
+}
+
+func TestCopy(t *testing.T) {
+	from, to := mock.New(), mock.New()
+	a := &distlock.LockKey{Namespace: "testns", Key: "a"}
+	b := &distlock.LockKey{Namespace: "testns", Key: "b"}
+	c := &distlock.LockKey{Namespace: "other", Key: "c"}
+	from.Set(a, "va", time.Second)
+	from.Set(b, "vb", 5*time.Second)
+	from.Set(c, "vc", 5*time.Second)
+	to.Set(b, "held", 5*time.Second)
+
+	stats, err := Copy(from, to, "testns")
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Listed: 2, Copied: 1, Skipped: 1}, stats)
+	assert.Equal(t, "va", to.Get(a))
+	assert.Equal(t, "held", to.Get(b))
+	assert.False(t, to.Exists(c))
+
+	// remaining TTL is kept
+	time.Sleep(1100 * time.Millisecond)
+	assert.False(t, to.Exists(a))
+
+	_, err = Copy(plainStore{from}, to, "testns")
+	assert.True(t, errors.Is(err, distlock.ErrNotLister))
+
+	// never expiring ones aren't copied
+	stats, err = Copy(persistentStore{from}, to, "testns")
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Listed: 1, Persistent: 1, PersistentKeys: []distlock.LockKey{*b}}, stats)
+	assert.Equal(t, "held", to.Get(b))
+}
+
+func TestRun(t *testing.T) {
+	from, to := mock.New(), mock.New()
+	from.Set(&distlock.LockKey{Namespace: "ns1", Key: "a"}, "va", 5*time.Second)
+	from.Set(&distlock.LockKey{Namespace: "ns2", Key: "b"}, "vb", 5*time.Second)
+	var addrs []string
+	openers := map[string]Opener{
+		"old": func(addr string) (distlock.Store, error) {
+			addrs = append(addrs, addr)
+			return from, nil
+		},
+		"new": func(addr string) (distlock.Store, error) {
+			addrs = append(addrs, addr)
+			return to, nil
+		},
+	}
+
+	out := &bytes.Buffer{}
+	err := Run([]string{"-from", "old://127.0.0.1:1", "-namespaces", "ns1", "-dry-run"}, openers, out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "ns1\ta\tva\t")
+	assert.Equal(t, []string{"127.0.0.1:1"}, addrs)
+	assert.False(t, to.Exists(&distlock.LockKey{Namespace: "ns1", Key: "a"}))
+
+	// closed by the last run
+	from, to = mock.New(), mock.New()
+	from.Set(&distlock.LockKey{Namespace: "ns1", Key: "a"}, "va", 5*time.Second)
+	from.Set(&distlock.LockKey{Namespace: "ns2", Key: "b"}, "vb", 5*time.Second)
+	out.Reset()
+	err = Run([]string{"-from", "old://127.0.0.1:1", "-to", "new://127.0.0.1:2,127.0.0.1:3", "-namespaces", "ns1,ns2"}, openers, out)
+	assert.NoError(t, err)
+	assert.Equal(t, "ns1: 1 listed, 1 copied, 0 skipped, 0 never expiring\nns2: 1 listed, 1 copied, 0 skipped, 0 never expiring\n", out.String())
+	assert.Equal(t, "127.0.0.1:2,127.0.0.1:3", addrs[len(addrs)-1])
+	assert.Error(t, to.Ping())
+
+	// never expiring ones are listed and fail the run
+	from, to = mock.New(), mock.New()
+	from.Set(&distlock.LockKey{Namespace: "ns1", Key: "a"}, "va", 5*time.Second)
+	from.Set(&distlock.LockKey{Namespace: "ns2", Key: "b"}, "vb", 5*time.Second)
+	openers["persistent"] = func(addr string) (distlock.Store, error) {
+		return persistentStore{from}, nil
+	}
+	out.Reset()
+	err = Run([]string{"-from", "persistent://", "-to", "new://", "-namespaces", "ns1,ns2"}, openers, out)
+	assert.True(t, errors.Is(err, ErrPersistentLocks))
+	assert.Equal(t, "ns1: 1 listed, 0 copied, 0 skipped, 1 never expiring\nns1\ta\tnever expires, copy it by hand\n"+
+		"ns2: 1 listed, 0 copied, 0 skipped, 1 never expiring\nns2\tb\tnever expires, copy it by hand\n", out.String())
+
+	err = Run([]string{"-from", "absent://127.0.0.1:1", "-to", "new://", "-namespaces", "ns1"}, openers, out)
+	assert.True(t, errors.Is(err, ErrUnknownScheme))
+	assert.Error(t, Run([]string{"-from", "old://127.0.0.1:1"}, openers, out))
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package migrate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+)
+
+// MigratingStore writes to both the old store and the new one, and reads from the old one
+//	then the new one. Locks can be moved between backends without downtime by:
+//	1. Replacing the store of every instance with a MigratingStore
+//	2. Copying the locks acquired before step 1 by {Copy}
+//	3. Replacing the MigratingStore of every instance with the new store
+//	The old store is the authority until step 3, and acquiring fails if the lock is held
+//	in the new store by someone else, eg. an instance which has finished step 3.
+type MigratingStore struct {
+	from, to distlock.AtomicStore
+}
+
+// NewMigratingStore returns a store moving locks from {from} to {to}
+func NewMigratingStore(from, to distlock.AtomicStore) *MigratingStore {
+	return &MigratingStore{
+		from: from,
+		to:   to,
+	}
+}
+
+// Keep renews the lock in the new store only if it's the same as the old one or not copied yet
+func (m *MigratingStore) Keep(lockKey *distlock.LockKey, val string, expire time.Duration) {
+	old := m.from.Get(lockKey)
+	m.from.Keep(lockKey, val, expire)
+	m.mirror(lockKey, old, val, expire)
+}
+
+func (m *MigratingStore) Exists(lockKey *distlock.LockKey) bool {
+	return m.from.Exists(lockKey) || m.to.Exists(lockKey)
+}
+
+func (m *MigratingStore) Get(lockKey *distlock.LockKey) string {
+	if val := m.from.Get(lockKey); val != "" {
+		return val
+	}
+	return m.to.Get(lockKey)
+}
+
+// mirror applies the swap to the new store, where the lock may not be copied yet
+func (m *MigratingStore) mirror(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	if m.to.CompareAndSwap(lockKey, old, val, expire) {
+		return true
+	}
+	cur := m.to.Get(lockKey)
+	if cur == val {
+		return true
+	}
+	if cur == "" {
+		return m.to.CompareAndSwap(lockKey, "", val, expire)
+	}
+	return false
+}
+
+func (m *MigratingStore) SetIfAbsent(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
+	if !m.from.SetIfAbsent(lockKey, val, expire) {
+		return false
+	}
+	if m.mirror(lockKey, "", val, expire) {
+		return true
+	}
+	// held by someone else in the new store
+	m.from.Delete(lockKey)
+	return false
+}
+
+func (m *MigratingStore) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	if !m.from.CompareAndSwap(lockKey, old, val, expire) {
+		return false
+	}
+	if m.mirror(lockKey, old, val, expire) {
+		return true
+	}
+	// held by someone else in the new store, roll back
+	if old == "" {
+		m.from.Delete(lockKey)
+	} else {
+		m.from.CompareAndSwap(lockKey, val, old, expire)
+	}
+	return false
+}
+
+// Set never overwrites the new store if the value there differs from the old one
+func (m *MigratingStore) Set(lockKey *distlock.LockKey, val string, expire time.Duration) {
+	old := m.from.Get(lockKey)
+	m.from.Set(lockKey, val, expire)
+	m.mirror(lockKey, old, val, expire)
+}
+
+func (m *MigratingStore) Delete(lockKey *distlock.LockKey) {
+	m.from.Delete(lockKey)
+	m.to.Delete(lockKey)
+}
+
+// Watch merges the changes notified by both stores if they're WatchStores
+func (m *MigratingStore) Watch(ctx context.Context, lockKey *distlock.LockKey) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	wg := sync.WaitGroup{}
+	for _, s := range []distlock.Store{m.from, m.to} {
+		watcher, ok := s.(distlock.WatchStore)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(watchC <-chan struct{}) {
+			defer wg.Done()
+			for range watchC {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}(watcher.Watch(ctx, lockKey))
+	}
+	go func() {
+		<-ctx.Done()
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+// Ping returns the first error of the stores which are Pingers
+func (m *MigratingStore) Ping() error {
+	for _, s := range []distlock.Store{m.from, m.to} {
+		if pinger, ok := s.(distlock.Pinger); ok {
+			if err := pinger.Ping(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateKey accepts only the keys valid in both stores
+func (m *MigratingStore) ValidateKey(lockKey *distlock.LockKey) error {
+	for _, s := range []distlock.Store{m.from, m.to} {
+		if validator, ok := s.(distlock.KeyValidator); ok {
+			if err := validator.ValidateKey(lockKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MaxValueLength returns the smaller limit of both stores
+func (m *MigratingStore) MaxValueLength() int {
+	max := 0
+	for _, s := range []distlock.Store{m.from, m.to} {
+		if limiter, ok := s.(distlock.ValueLimiter); ok {
+			if l := limiter.MaxValueLength(); l > 0 && (max == 0 || l < max) {
+				max = l
+			}
+		}
+	}
+	return max
+}
+
+// List returns the locks of the old store along with the ones only in the new store
+func (m *MigratingStore) List(namespace string) ([]distlock.Entry, error) {
+	entries, err := list(m.from, namespace)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		listed[e.LockKey.Key] = true
+	}
+	more, err := list(m.to, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range more {
+		if !listed[e.LockKey.Key] {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (m *MigratingStore) Close() {
+	m.from.Close()
+	m.to.Close()
+}
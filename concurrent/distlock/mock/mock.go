@@ -1,6 +1,8 @@
 package mock
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"time"
 
@@ -8,22 +10,63 @@ import (
 )
 
 type item struct {
-	val   string
-	dueTo int64 // in nano
+	lockKey distlock.LockKey
+	val     string
+	dueTo   int64 // in nano
 }
 
 type MockLocker struct {
 	sync.Mutex
-	store   map[string]*item
-	stopped bool
+	store    map[string]*item
+	watchers map[string][]chan struct{}
+	stopped  bool
 }
 
 func New() *MockLocker {
 	return &MockLocker{
-		store: make(map[string]*item),
+		store:    make(map[string]*item),
+		watchers: make(map[string][]chan struct{}),
 	}
 }
 
+// notify signals all watchers of the key, lock should be held
+func (m *MockLocker) notify(key string) {
+	for _, ch := range m.watchers[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (m *MockLocker) Watch(ctx context.Context, lockKey *distlock.LockKey) <-chan struct{} {
+	m.Lock()
+	defer m.Unlock()
+	m.check()
+	key := lockKey.String()
+	ch := make(chan struct{}, 1)
+	m.watchers[key] = append(m.watchers[key], ch)
+	go func() {
+		<-ctx.Done()
+		m.Lock()
+		defer m.Unlock()
+		arr := m.watchers[key]
+		for i := range arr {
+			if arr[i] == ch {
+				arr = append(arr[:i], arr[i+1:]...)
+				break
+			}
+		}
+		if len(arr) == 0 {
+			delete(m.watchers, key)
+		} else {
+			m.watchers[key] = arr
+		}
+		close(ch)
+	}()
+	return ch
+}
+
 func (m *MockLocker) Close() {
 	m.Lock()
 	defer m.Unlock()
@@ -36,6 +79,15 @@ func (m *MockLocker) check() {
 	}
 }
 
+func (m *MockLocker) Ping() error {
+	m.Lock()
+	defer m.Unlock()
+	if m.stopped {
+		return errors.New("Locker has been closed")
+	}
+	return nil
+}
+
 func (m *MockLocker) Keep(lockKey *distlock.LockKey, val string, expire time.Duration) {
 	m.Lock()
 	defer m.Unlock()
@@ -45,6 +97,7 @@ func (m *MockLocker) Keep(lockKey *distlock.LockKey, val string, expire time.Dur
 	if ok {
 		t.dueTo = time.Now().UnixNano() + expire.Nanoseconds()
 		t.val = val
+		m.notify(key)
 	}
 }
 
@@ -84,9 +137,11 @@ func (m *MockLocker) Set(lockKey *distlock.LockKey, val string, expire time.Dura
 	m.check()
 	key := lockKey.String()
 	m.store[key] = &item{
-		val:   val,
-		dueTo: time.Now().UnixNano() + expire.Nanoseconds(),
+		lockKey: *lockKey,
+		val:     val,
+		dueTo:   time.Now().UnixNano() + expire.Nanoseconds(),
 	}
+	m.notify(key)
 }
 
 func (m *MockLocker) SetIfAbsent(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
@@ -98,9 +153,11 @@ func (m *MockLocker) SetIfAbsent(lockKey *distlock.LockKey, val string, expire t
 		return false
 	}
 	m.store[key] = &item{
-		val:   val,
-		dueTo: time.Now().UnixNano() + expire.Nanoseconds(),
+		lockKey: *lockKey,
+		val:     val,
+		dueTo:   time.Now().UnixNano() + expire.Nanoseconds(),
 	}
+	m.notify(key)
 	return true
 }
 
@@ -108,5 +165,47 @@ func (m *MockLocker) Delete(lockKey *distlock.LockKey) {
 	m.Lock()
 	defer m.Unlock()
 	m.check()
-	delete(m.store, lockKey.String())
+	key := lockKey.String()
+	delete(m.store, key)
+	m.notify(key)
+}
+
+func (m *MockLocker) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	m.Lock()
+	defer m.Unlock()
+	m.check()
+	key := lockKey.String()
+	cur := ""
+	if t, ok := m.store[key]; ok && t.dueTo >= time.Now().UnixNano() {
+		cur = t.val
+	}
+	if cur != old {
+		return false
+	}
+	m.store[key] = &item{
+		lockKey: *lockKey,
+		val:     val,
+		dueTo:   time.Now().UnixNano() + expire.Nanoseconds(),
+	}
+	m.notify(key)
+	return true
+}
+
+func (m *MockLocker) List(namespace string) ([]distlock.Entry, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.check()
+	now := time.Now().UnixNano()
+	var entries []distlock.Entry
+	for _, t := range m.store {
+		if t.lockKey.Namespace != namespace || t.dueTo < now {
+			continue
+		}
+		entries = append(entries, distlock.Entry{
+			LockKey: t.lockKey,
+			Value:   t.val,
+			TTL:     time.Duration(t.dueTo - now),
+		})
+	}
+	return entries, nil
 }
@@ -1,11 +1,473 @@
 package mock
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
 	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
 )
 
+// flakyStore behaves like a store whose backend is unreachable when it's down
+type flakyStore struct {
+	*MockLocker
+	down  int32
+	pings int32
+}
+
+func (s *flakyStore) isDown() bool { return atomic.LoadInt32(&s.down) > 0 }
+
+func (s *flakyStore) Exists(lockKey *distlock.LockKey) bool {
+	return !s.isDown() && s.MockLocker.Exists(lockKey)
+}
+
+func (s *flakyStore) Get(lockKey *distlock.LockKey) string {
+	if s.isDown() {
+		return ""
+	}
+	return s.MockLocker.Get(lockKey)
+}
+
+func (s *flakyStore) SetIfAbsent(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
+	return !s.isDown() && s.MockLocker.SetIfAbsent(lockKey, val, expire)
+}
+
+func (s *flakyStore) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	return !s.isDown() && s.MockLocker.CompareAndSwap(lockKey, old, val, expire)
+}
+
+func (s *flakyStore) Ping() error {
+	atomic.AddInt32(&s.pings, 1)
+	if s.isDown() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+// countingStore counts the calls of acquiring
+type countingStore struct {
+	*MockLocker
+	calls int32
+}
+
+func (s *countingStore) SetIfAbsent(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
+	atomic.AddInt32(&s.calls, 1)
+	return s.MockLocker.SetIfAbsent(lockKey, val, expire)
+}
+
+// renewingStore extends the expiration without writing like the leases of etcdv3
+type renewingStore struct {
+	*MockLocker
+	renews int32
+	sets   int32
+}
+
+func (s *renewingStore) Renew(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
+	if s.Get(lockKey) != val {
+		return false
+	}
+	atomic.AddInt32(&s.renews, 1)
+	s.MockLocker.Keep(lockKey, val, expire)
+	return true
+}
+
+func (s *renewingStore) Set(lockKey *distlock.LockKey, val string, expire time.Duration) {
+	atomic.AddInt32(&s.sets, 1)
+	s.MockLocker.Set(lockKey, val, expire)
+}
+
+// pathStore organizes keys in paths with limited length
+type pathStore struct {
+	*MockLocker
+}
+
+func (s *pathStore) ValidateKey(lockKey *distlock.LockKey) error {
+	if err := distlock.ValidatePathKey(lockKey); err != nil {
+		return err
+	}
+	return distlock.ValidateKeyLength(lockKey.String(), 100)
+}
+
+// lossyStore loses locks on demand
+type lossyStore struct {
+	*MockLocker
+	handler func(lockKey *distlock.LockKey)
+}
+
+func (s *lossyStore) OnLost(handler func(lockKey *distlock.LockKey)) (cancel func()) {
+	s.handler = handler
+	return func() { s.handler = nil }
+}
+
+func (s *lossyStore) lose(lockKey *distlock.LockKey) {
+	s.MockLocker.Delete(lockKey)
+	s.handler(lockKey)
+}
+
 func TestMock(t *testing.T) {
 	storetest.DoTest(t, New())
 }
+
+func TestUnavailable(t *testing.T) {
+	lock := distlock.NewMutex("testns", 2*time.Second, &flakyStore{MockLocker: New(), down: 1}).(*distlock.DistLockImpl)
+
+	err := lock.TryAcquire("a")
+	assert.True(t, errors.Is(err, distlock.ErrStoreUnavailable))
+	assert.EqualError(t, err, "Store is unavailable: connection refused")
+	start := time.Now()
+	assert.True(t, errors.Is(lock.Acquire("a", time.Second), distlock.ErrStoreUnavailable))
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+	assert.True(t, errors.Is(lock.Release("a"), distlock.ErrStoreUnavailable))
+	assert.True(t, errors.Is(lock.Renew("a"), distlock.ErrStoreUnavailable))
+	assert.Equal(t, distlock.LockFailed, lock.Lock("a", 50*time.Millisecond))
+}
+
+func TestPolicy(t *testing.T) {
+	store := &flakyStore{MockLocker: New(), down: 1}
+	lock := distlock.NewMutex("testns", 2*time.Second, store).(*distlock.DistLockImpl)
+	lock1 := distlock.NewMutex("testns", 2*time.Second, store).(*distlock.DistLockImpl)
+
+	lock.SetAvailabilityPolicy(distlock.FailOpen)
+	assert.NoError(t, lock.TryAcquire("a"))
+	// still a mutex in current process
+	assert.False(t, lock.TryLock("a"))
+	assert.NoError(t, lock.Renew("a"))
+	assert.NoError(t, lock.Release("a"))
+
+	lock.SetAvailabilityPolicy(distlock.FailLocal)
+	lock1.SetAvailabilityPolicy(distlock.FailLocal)
+	assert.NoError(t, lock.TryAcquire("a"))
+	var held *distlock.ErrHeld
+	assert.True(t, errors.As(lock1.TryAcquire("a"), &held))
+	assert.Equal(t, lock.OwnerID(), held.Owner)
+	assert.Equal(t, distlock.ErrTimeout, lock1.Acquire("a", 50*time.Millisecond))
+	assert.NoError(t, lock.Renew("a"))
+	assert.True(t, errors.Is(lock1.Release("a"), distlock.ErrStoreUnavailable))
+	assert.NoError(t, lock.Release("a"))
+	assert.NoError(t, lock1.TryAcquire("a"))
+
+	// back to the store after recovered
+	atomic.StoreInt32(&store.down, 0)
+	assert.NoError(t, lock1.Release("a"))
+	assert.NoError(t, lock.TryAcquire("a"))
+	assert.False(t, lock1.TryLock("a"))
+	assert.NoError(t, lock.Release("a"))
+}
+
+func TestBreaker(t *testing.T) {
+	store := &flakyStore{MockLocker: New()}
+	breaker := distlock.NewBreaker(store, 2, 200*time.Millisecond)
+	key := &distlock.LockKey{Namespace: "testns", Key: "a"}
+	breaker.Set(key, "a", time.Second)
+
+	assert.NoError(t, breaker.Ping())
+	atomic.StoreInt32(&store.down, 1)
+	assert.Error(t, breaker.Ping())
+	assert.True(t, breaker.Available())
+	assert.Error(t, breaker.Ping())
+	assert.False(t, breaker.Available())
+
+	// fail fast without touching the store
+	pings := atomic.LoadInt32(&store.pings)
+	assert.Equal(t, distlock.CircuitOpen, breaker.Ping())
+	assert.Equal(t, "", breaker.Get(key))
+	assert.Equal(t, pings, atomic.LoadInt32(&store.pings))
+
+	// probed periodically
+	time.Sleep(250 * time.Millisecond)
+	assert.False(t, breaker.Available())
+	assert.Equal(t, pings+1, atomic.LoadInt32(&store.pings))
+	atomic.StoreInt32(&store.down, 0)
+	assert.False(t, breaker.Available())
+	time.Sleep(250 * time.Millisecond)
+	assert.True(t, breaker.Available())
+	assert.Equal(t, "a", breaker.Get(key))
+
+	lock := distlock.NewMutex("testns", 2*time.Second, breaker).(*distlock.DistLockImpl)
+	assert.NoError(t, lock.TryAcquire("b"))
+	assert.NoError(t, lock.Release("b"))
+}
+
+func TestBreakerDataPath(t *testing.T) {
+	store := &flakyStore{MockLocker: New()}
+	breaker := distlock.NewBreaker(store, 2, 200*time.Millisecond)
+	key := &distlock.LockKey{Namespace: "testns", Key: "a"}
+
+	// failures of reading and writing open the circuit without pinging explicitly,
+	//	but they're confirmed once per interval only
+	assert.True(t, breaker.SetIfAbsent(key, "a", time.Second))
+	atomic.StoreInt32(&store.down, 1)
+	assert.Equal(t, "", breaker.Get(key))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&store.pings))
+	assert.False(t, breaker.Exists(key))
+	assert.False(t, breaker.SetIfAbsent(key, "b", time.Second))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&store.pings))
+	assert.True(t, breaker.Available())
+	time.Sleep(250 * time.Millisecond)
+	assert.False(t, breaker.SetIfAbsent(key, "b", time.Second))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&store.pings))
+	assert.False(t, breaker.Available())
+
+	// so does compare-and-swap of the atomic one
+	atomic.StoreInt32(&store.down, 0)
+	atomicBreaker := distlock.NewAtomicBreaker(store, 1, time.Second)
+	assert.True(t, atomicBreaker.CompareAndSwap(key, "a", "b", time.Second))
+	atomic.StoreInt32(&store.down, 1)
+	assert.False(t, atomicBreaker.CompareAndSwap(key, "b", "c", time.Second))
+	assert.False(t, atomicBreaker.Available())
+}
+
+func TestBreakerCapabilities(t *testing.T) {
+	// the same as the wrapped store
+	var breaker distlock.Store = distlock.NewBreaker(New(), 1, time.Second)
+	_, ok := breaker.(distlock.AtomicStore)
+	assert.True(t, ok)
+	_, ok = breaker.(distlock.WatchStore)
+	assert.True(t, ok)
+	_, ok = breaker.(distlock.Lister)
+	assert.True(t, ok)
+	_, ok = breaker.(distlock.LossNotifier)
+	assert.False(t, ok)
+	_, ok = breaker.(distlock.KeyValidator)
+	assert.False(t, ok)
+	_, ok = breaker.(distlock.ValueLimiter)
+	assert.False(t, ok)
+	_, ok = breaker.(distlock.Renewer)
+	assert.False(t, ok)
+	lock := distlock.NewMutex("testns", 2*time.Second, breaker).(*distlock.DistLockImpl)
+	assert.False(t, lock.OnLost(func(*distlock.LockKey) {}))
+
+	breaker = distlock.NewBreaker(&pathStore{New()}, 1, time.Second)
+	_, ok = breaker.(distlock.KeyValidator)
+	assert.True(t, ok)
+	storetest.DoTestKeyEncoder(t, breaker)
+
+	// renewed through the circuit
+	renewing := &renewingStore{MockLocker: New()}
+	breaker = distlock.NewBreaker(renewing, 1, time.Second)
+	_, ok = breaker.(distlock.Renewer)
+	assert.True(t, ok)
+	lock = distlock.NewMutex("testns", 2*time.Second, breaker).(*distlock.DistLockImpl)
+	assert.NoError(t, lock.TryAcquire("a"))
+	assert.NoError(t, lock.Renew("a"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&renewing.renews))
+}
+
+func TestOnceUnavailable(t *testing.T) {
+	fn := func() (string, error) {
+		t.Error("never executed")
+		return "", nil
+	}
+	_, err := distlock.Once(context.Background(), "a", time.Second, fn)
+	assert.True(t, errors.Is(err, distlock.ErrStoreUnavailable))
+
+	// fails rather than waits as if the lock were held
+	store := &flakyStore{MockLocker: New(), down: 1}
+	_, err = distlock.NewOnceGroup("testns", store).Once(context.Background(), "a", time.Second, fn)
+	assert.True(t, errors.Is(err, distlock.ErrStoreUnavailable))
+	_, err = distlock.NewOnceGroup("testns", &pathStore{New()}).Once(context.Background(), "a/b", time.Second, fn)
+	assert.True(t, errors.Is(err, distlock.ErrIllegalKey))
+}
+
+func TestLocalSlots(t *testing.T) {
+	store := &flakyStore{MockLocker: New()}
+	lock := distlock.NewMutex("testns", 2*time.Second, store).(*distlock.DistLockImpl)
+	other := distlock.NewMutex("testns", 2*time.Second, store).(*distlock.DistLockImpl)
+
+	// adopted ones are held locally, which answers without the store
+	assert.NoError(t, other.TryAcquire("a"))
+	assert.True(t, other.Transfer("a", lock.OwnerID()))
+	assert.True(t, lock.Adopt("a"))
+	atomic.StoreInt32(&store.down, 1)
+	var held *distlock.ErrHeld
+	if assert.True(t, errors.As(lock.TryAcquire("a"), &held)) {
+		assert.Equal(t, lock.OwnerID(), held.Owner)
+	}
+	atomic.StoreInt32(&store.down, 0)
+	assert.NoError(t, lock.Release("a"))
+
+	// kept if the store refuses releasing
+	assert.NoError(t, lock.TryAcquire("b"))
+	store.Delete(&distlock.LockKey{Namespace: "testns", Key: "b"})
+	assert.NoError(t, other.TryAcquire("b"))
+	assert.Equal(t, distlock.ErrNotOwner, lock.Release("b"))
+	atomic.StoreInt32(&store.down, 1)
+	held = nil
+	if assert.True(t, errors.As(lock.TryAcquire("b"), &held)) {
+		assert.Equal(t, lock.OwnerID(), held.Owner)
+	}
+	atomic.StoreInt32(&store.down, 0)
+	assert.NoError(t, other.Release("b"))
+}
+
+func TestCoalescing(t *testing.T) {
+	store := &countingStore{MockLocker: New()}
+	lock := distlock.NewMutex("testns", 2*time.Second, store)
+	other := distlock.NewMutex("testns", 2*time.Second, store)
+	assert.True(t, other.TryLock("a"))
+
+	var holding int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, lock.Lock("a", 3*time.Second))
+			assert.Equal(t, int32(1), atomic.AddInt32(&holding, 1))
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&holding, -1)
+			assert.True(t, lock.UnLock("a"))
+		}()
+	}
+	time.Sleep(300 * time.Millisecond)
+	// only one goroutine is polling
+	assert.True(t, atomic.LoadInt32(&store.calls) < 40)
+	assert.True(t, other.UnLock("a"))
+	wg.Wait()
+	assert.True(t, atomic.LoadInt32(&store.calls) < 60)
+}
+
+func TestHandover(t *testing.T) {
+	store := &countingStore{MockLocker: New()}
+	lock := distlock.NewReentry("testns", 2*time.Second, store)
+	other := distlock.NewMutex("testns", 2*time.Second, store)
+	assert.True(t, other.TryLock("a"))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, lock.Lock("a", 3*time.Second))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, other.UnLock("a"))
+	wg.Wait()
+	calls := atomic.LoadInt32(&store.calls)
+
+	// handed over locally without acquiring from store
+	assert.NoError(t, lock.Lock("a", time.Second))
+	assert.True(t, lock.TryLock("a"))
+	assert.Equal(t, calls, atomic.LoadInt32(&store.calls))
+	assert.False(t, other.TryLock("a"))
+	assert.True(t, lock.UnLock("a"))
+	assert.True(t, other.TryLock("a"))
+}
+
+func TestKeyValidation(t *testing.T) {
+	storetest.DoTestKeyEncoder(t, &pathStore{New()})
+
+	lock := distlock.NewMutex("testns", 2*time.Second, &pathStore{New()}).(*distlock.DistLockImpl)
+	illegal := []interface{}{"", ".", "..", "a/b", "a\x00", strings.Repeat("a", 100)}
+	for _, target := range illegal {
+		assert.True(t, errors.Is(lock.TryAcquire(target), distlock.ErrIllegalKey), target)
+		assert.True(t, errors.Is(lock.Acquire(target, 50*time.Millisecond), distlock.ErrIllegalKey), target)
+		assert.True(t, errors.Is(lock.Renew(target), distlock.ErrIllegalKey), target)
+		assert.True(t, errors.Is(lock.Release(target), distlock.ErrIllegalKey), target)
+	}
+	assert.True(t, lock.TryLock("a:b"))
+
+	lock.SetKeyEncoder(distlock.EscapedKeyEncoder)
+	for _, target := range illegal[1:5] {
+		assert.True(t, lock.TryLock(target), target)
+	}
+	lock.SetKeyEncoder(distlock.HashedKeyEncoder("h-"))
+	assert.True(t, lock.TryLock(illegal[5]))
+}
+
+func TestLost(t *testing.T) {
+	assert.False(t, distlock.NewMutex("testns", 2*time.Second, New()).(*distlock.DistLockImpl).OnLost(nil))
+
+	store := &lossyStore{MockLocker: New()}
+	lock := distlock.NewReentry("testns", 2*time.Second, store).(*distlock.DistLockImpl)
+	other := distlock.NewMutex("testns", 2*time.Second, store)
+	var lost []string
+	assert.True(t, lock.OnLost(func(lockKey *distlock.LockKey) {
+		lost = append(lost, lockKey.Key)
+	}))
+	assert.True(t, lock.OnLost(func(lockKey *distlock.LockKey) {
+		lost = append(lost, "again")
+	}))
+
+	assert.True(t, lock.TryLock("a"))
+	store.lose(&distlock.LockKey{Namespace: "testns", Key: "a"})
+	assert.Equal(t, []string{"a", "again"}, lost)
+	// not reentered locally any more
+	assert.True(t, other.TryLock("a"))
+	assert.False(t, lock.TryLock("a"))
+
+	// locks not held by myself
+	store.lose(&distlock.LockKey{Namespace: "testns", Key: "a"})
+	store.lose(&distlock.LockKey{Namespace: "testns", Key: "b"})
+	assert.Equal(t, 2, len(lost))
+
+	lock.Close()
+	assert.Nil(t, store.handler)
+}
+
+func TestHoldings(t *testing.T) {
+	mutex := distlock.NewHoldings("owner", false)
+	reentered, err := mutex.Enter("a")
+	assert.False(t, reentered)
+	assert.NoError(t, err)
+	mutex.Hold("a", "node-1")
+	reentered, err = mutex.Enter("a")
+	assert.False(t, reentered)
+	var held *distlock.ErrHeld
+	assert.True(t, errors.As(err, &held))
+	assert.Equal(t, "owner", held.Owner)
+	assert.True(t, errors.Is(err, distlock.LockFailed))
+
+	reentry := distlock.NewHoldings("owner", true)
+	reentry.Hold("a", "node-1")
+	reentry.Hold("b", "node-2")
+	reentered, err = reentry.Enter("a")
+	assert.True(t, reentered)
+	assert.NoError(t, err)
+	value, holding, last := reentry.Leave("a")
+	assert.Equal(t, "node-1", value)
+	assert.True(t, holding)
+	assert.False(t, last)
+	_, holding, last = reentry.Leave("a")
+	assert.True(t, holding)
+	assert.True(t, last)
+	_, holding, _ = reentry.Leave("a")
+	assert.False(t, holding)
+
+	value, ok := reentry.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, "node-2", value)
+	assert.Equal(t, map[string]interface{}{"b": "node-2"}, reentry.Clear())
+	_, ok = reentry.Remove("b")
+	assert.False(t, ok)
+}
+
+func TestRenewer(t *testing.T) {
+	store := &renewingStore{MockLocker: New()}
+	lock := distlock.NewMutex("testns", 300*time.Millisecond, store).(*distlock.DistLockImpl)
+	lock1 := distlock.NewMutex("testns", 300*time.Millisecond, store).(*distlock.DistLockImpl)
+	assert.NoError(t, lock.TryAcquire("a"))
+
+	// valid as long as it exists though the time written is older than TTL
+	for i := 0; i < 3; i++ {
+		time.Sleep(200 * time.Millisecond)
+		assert.NoError(t, lock.Renew("a"))
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&store.renews))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&store.sets))
+	var held *distlock.ErrHeld
+	assert.True(t, errors.As(lock1.TryAcquire("a"), &held))
+	assert.Equal(t, time.Duration(0), held.Remaining)
+
+	// written when the data changes
+	assert.NoError(t, lock.Renew("a", distlock.WithMetadata("host-1")))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&store.sets))
+	assert.NoError(t, lock.Release("a"))
+}
@@ -0,0 +1,224 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// result format: v|{value} or e|{error message}
+
+type onceCall struct {
+	done chan struct{}
+	val  string
+	err  error
+	// the leader quit without a result, by its context or a panic of fn
+	retry bool
+}
+
+// OnceGroup makes sure a function is executed only once across the cluster for the same key
+type OnceGroup struct {
+	sync.Mutex
+	store     Store
+	namespace string
+	calls     map[string]*onceCall
+}
+
+// NewOnceGroup returns a group sharing results through specified store
+//	namespace is used to separate different projects
+//	store decides which storage it uses
+func NewOnceGroup(namespace string, store Store) *OnceGroup {
+	if namespace == "" {
+		namespace = "distributed-lock"
+	}
+	return &OnceGroup{
+		store:     store,
+		namespace: namespace,
+		calls:     make(map[string]*onceCall),
+	}
+}
+
+// defaultOnce is the group of the package function {Once}
+var defaultOnce = struct {
+	sync.Mutex
+	group *OnceGroup
+}{}
+
+// SetDefaultOnceGroup sets the group used by the package function {Once}, eg.
+//	distlock.SetDefaultOnceGroup(distlock.NewOnceGroup("project-namespace", store))
+func SetDefaultOnceGroup(group *OnceGroup) {
+	defaultOnce.Lock()
+	defer defaultOnce.Unlock()
+	defaultOnce.group = group
+}
+
+// Once executes fn by the group set by {SetDefaultOnceGroup}, see {OnceGroup.Once}.
+//	It fails with ErrStoreUnavailable if no group has been set.
+func Once(ctx context.Context, key interface{}, ttl time.Duration, fn func() (string, error)) (string, error) {
+	defaultOnce.Lock()
+	group := defaultOnce.group
+	defaultOnce.Unlock()
+	if group == nil {
+		return "", fmt.Errorf("%w: no default group of Once", ErrStoreUnavailable)
+	}
+	return group.Once(ctx, key, ttl, fn)
+}
+
+func encodeResult(val string, err error) string {
+	if err != nil {
+		return "e|" + err.Error()
+	}
+	return "v|" + val
+}
+
+func decodeResult(data string) (val string, ok bool, err error) {
+	if len(data) < 2 || data[1] != '|' {
+		return
+	}
+	switch data[0] {
+	case 'v':
+		return data[2:], true, nil
+	case 'e':
+		return "", true, errors.New(data[2:])
+	}
+	return
+}
+
+// Once executes fn only once for the key in the whole cluster during {ttl}.
+//	Only one process runs fn while others wait for and receive its result or error,
+//	and in a process only one goroutine talks to the store for the same key.
+//	ttl is used as both the expiration of the lock and the shared result, and the lock is
+//	renewed while fn is running longer than it.
+//	A result longer than the limit of a {ValueLimiter} store is replaced by ErrValueTooLong.
+//	If the goroutine talking to the store quits by its context or a panic of fn, the waiting
+//	ones take over rather than share its error.
+//	The error of fn is shared as is in current process, but only its message is stored for
+//	other processes, so they receive a plain error which errors.Is can't match with sentinels.
+//	Errors of the store, like ErrStoreUnavailable or ErrIllegalKey, are returned immediately.
+func (g *OnceGroup) Once(ctx context.Context, key interface{}, ttl time.Duration, fn func() (string, error)) (string, error) {
+	k, err := g.key(key)
+	if err != nil {
+		return "", err
+	}
+	for {
+		g.Lock()
+		call, ok := g.calls[k]
+		if !ok {
+			call = &onceCall{done: make(chan struct{}), retry: true}
+			g.calls[k] = call
+			g.Unlock()
+			return g.lead(ctx, k, call, ttl, fn)
+		}
+		g.Unlock()
+		select {
+		case <-call.done:
+			if !call.retry {
+				return call.val, call.err
+			}
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// key encodes the key of call, and validates the keys of lock and result derived from it
+func (g *OnceGroup) key(key interface{}) (string, error) {
+	lockKey, err := NewLockKey(g.store, nil, g.namespace, key)
+	if err != nil {
+		return "", err
+	}
+	for _, prefix := range []string{"once::", "once-result::"} {
+		if _, err := NewLockKey(g.store, nil, g.namespace, prefix+lockKey.Key); err != nil {
+			return "", err
+		}
+	}
+	return lockKey.Key, nil
+}
+
+// lead talks to the store for call, which is released even if fn panics
+func (g *OnceGroup) lead(ctx context.Context, key string, call *onceCall, ttl time.Duration, fn func() (string, error)) (string, error) {
+	defer func() {
+		g.Lock()
+		delete(g.calls, key)
+		g.Unlock()
+		close(call.done)
+	}()
+	val, ok, err := g.do(ctx, key, ttl, fn)
+	call.val, call.err, call.retry = val, err, !ok
+	return val, err
+}
+
+// do returns the result shared or of fn, and ok is false if ctx is done before it.
+//	It waits only while the lock is held by others, and fails with other errors of acquiring.
+func (g *OnceGroup) do(ctx context.Context, key string, ttl time.Duration, fn func() (string, error)) (val string, ok bool, err error) {
+	resultKey := &LockKey{
+		Namespace: g.namespace,
+		Key:       "once-result::" + key,
+	}
+	lock := NewMutex(g.namespace, ttl, g.store).(*DistLockImpl)
+	target := "once::" + key
+	for {
+		if val, ok, err := decodeResult(g.store.Get(resultKey)); ok {
+			return val, true, err
+		}
+		err := lock.TryAcquire(target)
+		if err == nil {
+			val, err := g.run(lock, target, resultKey, ttl, fn)
+			return val, true, err
+		}
+		if !errors.Is(err, LockFailed) {
+			return "", true, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		case <-time.After(TRY_INTERVAL):
+		}
+	}
+}
+
+// run executes fn and shares its result with the lock held, which is renewed meanwhile
+//	and released even if fn panics.
+func (g *OnceGroup) run(lock DistLock, target string, resultKey *LockKey, ttl time.Duration, fn func() (string, error)) (string, error) {
+	defer lock.UnLock(target)
+	// the holder before may have just finished
+	if val, ok, err := decodeResult(g.store.Get(resultKey)); ok {
+		return val, err
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				lock.Keep(target)
+			}
+		}
+	}()
+	defer func() {
+		// never renew after released
+		close(stop)
+		<-stopped
+	}()
+
+	val, err := fn()
+	result := encodeResult(val, err)
+	if e := checkValue(g.store, result); e != nil {
+		val, err = "", e
+		result = encodeResult(val, err)
+	}
+	g.store.Set(resultKey, result, ttl)
+	return val, err
+}
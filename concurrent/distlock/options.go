@@ -0,0 +1,104 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"time"
+)
+
+// LockOption customizes a single call of {TryLockWith}, {LockWith} or {KeepWith}
+type LockOption func(o *lockOptions)
+
+type lockOptions struct {
+	// ttl is zero if not specified
+	ttl         time.Duration
+	wait        time.Duration
+	retry       time.Duration
+	metadata    string
+	hasMetadata bool
+}
+
+// WithTTL overrides the expiration given at construction for this call.
+//	The TTL is written in lock data so all owners respect it, and it's kept when renewing
+//	or reentering unless overridden again.
+func WithTTL(ttl time.Duration) LockOption {
+	return func(o *lockOptions) {
+		if ttl > 0 {
+			o.ttl = ttl
+		}
+	}
+}
+
+// WithWait specifies how long to wait for the lock, no waiting by default
+func WithWait(wait time.Duration) LockOption {
+	return func(o *lockOptions) {
+		if wait > 0 {
+			o.wait = wait
+		}
+	}
+}
+
+// WithRetry specifies the interval between attempts while waiting, TRY_INTERVAL by default
+func WithRetry(interval time.Duration) LockOption {
+	return func(o *lockOptions) {
+		if interval > 0 {
+			o.retry = interval
+		}
+	}
+}
+
+// WithMetadata attaches a string to the lock data which can be seen by other owners
+//	through {ErrHeld} or {Inspect}. It's kept when renewing or reentering unless overridden.
+//	The call fails with ErrValueTooLong if the lock data exceeds the limit of a {ValueLimiter}.
+func WithMetadata(metadata string) LockOption {
+	return func(o *lockOptions) {
+		o.metadata = metadata
+		o.hasMetadata = true
+	}
+}
+
+func newLockOptions(opts []LockOption) *lockOptions {
+	o := &lockOptions{
+		retry: TRY_INTERVAL,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// inherit fills the unspecified ttl and metadata from the lock data held by myself
+func (l *DistLockImpl) inherit(o *lockOptions, val string) *lockOptions {
+	result := *o
+	info := parseLockInfo(val)
+	if info != nil && info.Owner == l.uuid {
+		if result.ttl == 0 {
+			result.ttl = info.TTL
+		}
+		if !result.hasMetadata {
+			result.metadata = info.Metadata
+		}
+	}
+	if result.ttl == 0 {
+		result.ttl = l.expire
+	}
+	return &result
+}
+
+// checkMetadata returns ErrValueTooLong if the lock data with metadata specified can't be stored
+func (l *DistLockImpl) checkMetadata(o *lockOptions) error {
+	if !o.hasMetadata {
+		return nil
+	}
+	return checkValue(l.store, l.lockData(l.uuid, l.inherit(o, "")))
+}
+
+// ttl returns the expiration of lock data
+func (l *DistLockImpl) ttl(info *LockInfo) time.Duration {
+	if info.TTL > 0 {
+		return info.TTL
+	}
+	return l.expire
+}
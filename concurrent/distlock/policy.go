@@ -0,0 +1,82 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"sync"
+	"time"
+)
+
+// AvailabilityPolicy decides what a lock does when its store is unavailable
+type AvailabilityPolicy int
+
+const (
+	// FailClosed fails immediately without waiting
+	FailClosed AvailabilityPolicy = iota
+	// FailOpen regards the lock as acquired with a warning
+	FailOpen
+	// FailLocal falls back to an in-process lock shared by all locks in current process
+	FailLocal
+)
+
+type localLock struct {
+	owner  string
+	locked time.Time
+	expire time.Duration
+}
+
+// localLocks is the fallback of all locks in current process
+var localLocks = struct {
+	sync.Mutex
+	locks map[string]*localLock
+}{
+	locks: make(map[string]*localLock),
+}
+
+func (l *DistLockImpl) localAcquire(lockKey *LockKey, expire time.Duration) error {
+	localLocks.Lock()
+	defer localLocks.Unlock()
+	key := lockKey.String()
+	now := time.Now()
+	if lock, ok := localLocks.locks[key]; ok && now.Sub(lock.locked) <= lock.expire {
+		if !l.reentry || lock.owner != l.uuid {
+			return &ErrHeld{
+				LockInfo: LockInfo{
+					Owner:  lock.owner,
+					Locked: lock.locked,
+				},
+				Remaining: lock.locked.Add(lock.expire).Sub(now),
+			}
+		}
+	}
+	localLocks.locks[key] = &localLock{
+		owner:  l.uuid,
+		locked: now,
+		expire: expire,
+	}
+	return nil
+}
+
+func (l *DistLockImpl) localRelease(lockKey *LockKey) bool {
+	localLocks.Lock()
+	defer localLocks.Unlock()
+	key := lockKey.String()
+	if lock, ok := localLocks.locks[key]; ok && lock.owner == l.uuid {
+		delete(localLocks.locks, key)
+		return true
+	}
+	return false
+}
+
+func (l *DistLockImpl) localRenew(lockKey *LockKey) bool {
+	localLocks.Lock()
+	defer localLocks.Unlock()
+	if lock, ok := localLocks.locks[lockKey.String()]; ok && lock.owner == l.uuid &&
+		time.Since(lock.locked) <= lock.expire {
+		lock.locked = time.Now()
+		return true
+	}
+	return false
+}
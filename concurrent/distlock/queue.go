@@ -0,0 +1,153 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"time"
+)
+
+// SWEEP_THRESHOLD is the number of slots to start sweeping the stale ones
+const SWEEP_THRESHOLD = 1024
+
+// Goroutines of current process contending for the same key are queued locally, so only one
+//	of them talks to the store at a time while the others wait for it. A reentry lock held
+//	by current process is handed over to the waiting ones without going through the store.
+
+type slot struct {
+	// acquiring indicates a goroutine is acquiring it from store
+	acquiring bool
+	held      bool
+	since     time.Time
+	expire    time.Duration
+	waiters   int
+	// changed is closed and replaced whenever the state changes
+	changed chan struct{}
+}
+
+// stale returns true if the lock held should have expired without renewal
+func (s *slot) stale(now time.Time) bool {
+	return s.held && now.Sub(s.since) > s.expire
+}
+
+func (s *slot) busy(now time.Time) bool {
+	return s.acquiring || (s.held && !s.stale(now))
+}
+
+func (s *slot) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// slot returns the slot of key, queueMutex should be held
+func (l *DistLockImpl) slot(key string) *slot {
+	if l.slots == nil {
+		l.slots = make(map[string]*slot)
+	}
+	s, ok := l.slots[key]
+	if !ok {
+		s = &slot{changed: make(chan struct{})}
+		l.slots[key] = s
+	}
+	return s
+}
+
+// cleanup removes the idle slot, queueMutex should be held
+func (l *DistLockImpl) cleanup(key string, s *slot) {
+	if !s.acquiring && !s.held && s.waiters == 0 {
+		delete(l.slots, key)
+	}
+}
+
+// enter waits until it's our turn to acquire from the store before deadline,
+//	or returns reenter=true when the lock held can be reentered directly.
+//	It doesn't wait if the deadline is zero.
+func (l *DistLockImpl) enter(key string, deadline time.Time) (reenter bool, err error) {
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	for {
+		now := time.Now()
+		s := l.slot(key)
+		if !s.busy(now) {
+			s.acquiring = true
+			s.held = false
+			return false, nil
+		}
+		if l.reentry && s.held {
+			s.since = now
+			return true, nil
+		}
+		if deadline.IsZero() {
+			err := &ErrHeld{}
+			if s.held {
+				err.Owner = l.uuid
+				err.Locked = s.since
+				err.Remaining = s.since.Add(s.expire).Sub(now)
+			}
+			return false, err
+		}
+		if !now.Before(deadline) {
+			return false, ErrTimeout
+		}
+		wait := deadline.Sub(now)
+		if s.held && s.since.Add(s.expire).Sub(now) < wait {
+			// wake up when it becomes stale
+			wait = s.since.Add(s.expire).Sub(now) + time.Millisecond
+		}
+		s.waiters++
+		changed := s.changed
+		l.queueMutex.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+		l.queueMutex.Lock()
+		s.waiters--
+	}
+}
+
+// leave finishes acquiring and wakes up the waiting ones
+func (l *DistLockImpl) leave(key string, acquired bool, expire time.Duration) {
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	s := l.slot(key)
+	s.acquiring = false
+	s.held = acquired
+	s.since = time.Now()
+	s.expire = expire
+	s.notify()
+	l.cleanup(key, s)
+	if len(l.slots) > SWEEP_THRESHOLD {
+		// locks never released
+		now := time.Now()
+		for k, s := range l.slots {
+			if s.stale(now) && !s.acquiring && s.waiters == 0 {
+				delete(l.slots, k)
+			}
+		}
+	}
+}
+
+// renewed refreshes the lock held locally
+func (l *DistLockImpl) renewed(key string, expire time.Duration) {
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	if s, ok := l.slots[key]; ok && s.held {
+		s.since = time.Now()
+		s.expire = expire
+	}
+}
+
+// released marks the lock as free and wakes up the waiting ones
+func (l *DistLockImpl) released(key string) {
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	if s, ok := l.slots[key]; ok && s.held {
+		s.held = false
+		s.notify()
+		l.cleanup(key, s)
+	}
+}
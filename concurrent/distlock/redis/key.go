@@ -0,0 +1,69 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"strings"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+)
+
+// Keys are laid out as LockKey.String(), lock::<namespace>::<key>[::<auxiliary>], by default.
+//	With {WithHashTags} they're lock::{<namespace>::<key>}[::<auxiliary>], whose hash tag places
+//	all keys of a lock into the same slot of cluster, so scripts accessing several of them never
+//	fail with CROSSSLOT. Keys of script locks always have the hash tag whatever the option is.
+
+func namespaceOf(lockKey *distlock.LockKey) string {
+	if lockKey.Namespace == "" {
+		return "distributed-lock"
+	}
+	return lockKey.Namespace
+}
+
+// hashTagKey returns the key of lock, or the auxiliary one of it if aux is specified
+func hashTagKey(lockKey *distlock.LockKey, aux ...string) string {
+	b := strings.Builder{}
+	b.WriteString("lock::{")
+	b.WriteString(namespaceOf(lockKey))
+	b.WriteString("::")
+	b.WriteString(lockKey.Key)
+	b.WriteString("}")
+	for _, a := range aux {
+		b.WriteString("::")
+		b.WriteString(a)
+	}
+	return b.String()
+}
+
+func (r *RedisLocker) key(lockKey *distlock.LockKey) string {
+	if r.hashTags {
+		return hashTagKey(lockKey)
+	}
+	return lockKey.String()
+}
+
+// keyOf returns the key of lock from the one in redis, or false if it's not a lock of namespace
+func (r *RedisLocker) keyOf(namespace, key string) (string, bool) {
+	lockKey := &distlock.LockKey{Namespace: namespace}
+	if !r.hashTags {
+		prefix := lockKey.String()
+		return strings.TrimPrefix(key, prefix), strings.HasPrefix(key, prefix)
+	}
+	prefix := "lock::{" + namespaceOf(lockKey) + "::"
+	if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, "}") {
+		// auxiliary keys
+		return "", false
+	}
+	return key[len(prefix) : len(key)-1], true
+}
+
+// keyPattern returns the pattern of SCAN matching the locks of namespace
+func (r *RedisLocker) keyPattern(namespace string) string {
+	lockKey := &distlock.LockKey{Namespace: namespace}
+	if !r.hashTags {
+		return globEscaper.Replace(lockKey.String()) + "*"
+	}
+	return globEscaper.Replace("lock::{"+namespaceOf(lockKey)+"::") + "*}"
+}
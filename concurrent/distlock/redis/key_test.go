@@ -0,0 +1,238 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/stretchr/testify/assert"
+)
+
+// slot is the same as the one of redis cluster, CRC16 (XMODEM) of the hash tag or whole key mod 16384
+func slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	crc := uint16(0)
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return int(crc) % 16384
+}
+
+func TestSlot(t *testing.T) {
+	// examples in cluster specification
+	assert.Equal(t, 12739, slot("123456789"))
+	assert.Equal(t, slot("user1000"), slot("{user1000}.following"))
+	assert.Equal(t, slot("user1000"), slot("{user1000}.followers"))
+	assert.NotEqual(t, slot("{}a"), slot("{}b"))
+}
+
+func TestKeyLayout(t *testing.T) {
+	// legacy by default
+	r := &RedisLocker{}
+	k := &distlock.LockKey{Namespace: "testns", Key: "a"}
+	assert.Equal(t, k.String(), r.key(k))
+	key, ok := r.keyOf("testns", "lock::testns::a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", key)
+	assert.Equal(t, "lock::testns::*", r.keyPattern("testns"))
+
+	hashed := &RedisLocker{hashTags: true}
+	for _, k := range []distlock.LockKey{
+		{Namespace: "testns", Key: "a"},
+		{Namespace: "testns", Key: "b::c"},
+		{Namespace: "", Key: "1111"},
+		{Namespace: "other", Key: "{x}"},
+	} {
+		key := hashed.key(&k)
+		assert.Equal(t, slot(key), slot(hashTagKey(&k, "fence")), key)
+		assert.Equal(t, slot(key), slot(key+"::fence"), key)
+	}
+	assert.Equal(t, "lock::{testns::a}", hashed.key(&distlock.LockKey{Namespace: "testns", Key: "a"}))
+	assert.Equal(t, "lock::{distributed-lock::a}::fence", hashTagKey(&distlock.LockKey{Key: "a"}, "fence"))
+
+	key, ok = hashed.keyOf("testns", "lock::{testns::b::c}")
+	assert.True(t, ok)
+	assert.Equal(t, "b::c", key)
+	_, ok = hashed.keyOf("testns", "lock::{testns::b::c}::fence")
+	assert.False(t, ok)
+	_, ok = hashed.keyOf("testns", "lock::testns::b")
+	assert.False(t, ok)
+	assert.Equal(t, "lock::{testns::*}", hashed.keyPattern("testns"))
+
+	// script locks are tagged with either layout
+	for _, r := range []*RedisLocker{r, hashed} {
+		key, err := newScriptLock("testns", time.Second, r, false).key("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "lock::{testns-script::a}", key)
+	}
+}
+
+// fakeCluster is a stand-in of a cluster of two nodes splitting the slots in halves, which
+//	checks the slots of keys of scripts like the real one and pretends they succeed.
+type fakeCluster struct {
+	listeners []net.Listener
+	mutex     sync.Mutex
+	// evaluated scripts by node
+	evals map[int]int
+}
+
+func newFakeCluster(t *testing.T) *fakeCluster {
+	c := &fakeCluster{evals: make(map[int]int)}
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.listeners = append(c.listeners, l)
+	}
+	for i, l := range c.listeners {
+		go func(node int, l net.Listener) {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go c.serve(node, conn)
+			}
+		}(i, l)
+	}
+	t.Cleanup(func() {
+		for _, l := range c.listeners {
+			l.Close()
+		}
+	})
+	return c
+}
+
+func (c *fakeCluster) addrs() []string {
+	addrs := make([]string, len(c.listeners))
+	for i, l := range c.listeners {
+		addrs[i] = l.Addr().String()
+	}
+	return addrs
+}
+
+func (c *fakeCluster) node(slot int) int {
+	return slot * len(c.listeners) / 16384
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func (c *fakeCluster) reply(node int, args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "COMMAND":
+		// the same as real ones, keys of scripts are located by numkeys
+		reply := "*2\r\n"
+		for _, name := range []string{"eval", "evalsha"} {
+			reply += "*6\r\n" + bulk(name) + ":-3\r\n*2\r\n+noscript\r\n+movablekeys\r\n:0\r\n:0\r\n:0\r\n"
+		}
+		return reply
+	case "CLUSTER":
+		reply := fmt.Sprintf("*%d\r\n", len(c.listeners))
+		for i, l := range c.listeners {
+			host, port, _ := net.SplitHostPort(l.Addr().String())
+			reply += fmt.Sprintf("*3\r\n:%d\r\n:%d\r\n*2\r\n", i*16384/len(c.listeners), (i+1)*16384/len(c.listeners)-1)
+			reply += bulk(host) + bulk(port)
+		}
+		return reply
+	case "EVAL", "EVALSHA":
+		n, _ := strconv.Atoi(args[2])
+		s := slot(args[3])
+		for _, key := range args[4 : 3+n] {
+			if slot(key) != s {
+				return "-CROSSSLOT Keys in request don't hash to the same slot\r\n"
+			}
+		}
+		if owner := c.node(s); owner != node {
+			return fmt.Sprintf("-MOVED %d %s\r\n", s, c.listeners[owner].Addr().String())
+		}
+		if strings.ToUpper(args[0]) == "EVALSHA" {
+			return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		}
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.evals[node]++
+		return ":1\r\n"
+	}
+	return "+OK\r\n"
+}
+
+func (c *fakeCluster) serve(node int, conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+		args := make([]string, n)
+		// bulk strings may contain line breaks, like scripts
+		for i := range args {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, arg); err != nil {
+				return
+			}
+			args[i] = string(arg[:size])
+		}
+		if n == 0 {
+			continue
+		}
+		conn.Write([]byte(c.reply(node, args)))
+	}
+}
+
+func TestScriptLockInCluster(t *testing.T) {
+	c := newFakeCluster(t)
+	// scripts access a single key, so they work with either layout
+	for _, opts := range [][]Option{nil, {WithHashTags()}} {
+		opts = append(opts, WithTimeouts(time.Second, time.Second, time.Second))
+		locker, err := NewWithOptions(c.addrs(), opts...)
+		assert.NoError(t, err)
+		lock := newScriptLock("testns", 2*time.Second, locker, false)
+
+		// keys of both halves of slots
+		c.mutex.Lock()
+		c.evals = make(map[int]int)
+		c.mutex.Unlock()
+		nodes := make(map[int]bool)
+		for i := 0; i < 20; i++ {
+			assert.True(t, lock.TryLock(i))
+			key, err := lock.key(i)
+			assert.NoError(t, err)
+			nodes[c.node(slot(key))] = true
+		}
+		assert.Len(t, nodes, 2)
+		assert.Equal(t, 20, c.evals[0]+c.evals[1])
+		locker.Close()
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"crypto/tls"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+)
+
+// The client created by NewWithOptions is:
+//	a sentinel-backed failover client if WithMasterName is specified, or
+//	a cluster client if WithCluster is specified or more than one address is given, or
+//	a single-node client otherwise.
+
+type redisLockerConfig struct {
+	options  goredis.UniversalOptions
+	tls      *distlock.TLSConfig
+	cluster  bool
+	hashTags bool
+}
+
+type Option func(cfg *redisLockerConfig)
+
+// WithTLS connects to the servers over TLS
+func WithTLS(tls distlock.TLSConfig) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.tls = &tls
+	}
+}
+
+// WithTLSConfig connects to the servers over TLS with a config built already, overridden by WithTLS
+func WithTLSConfig(config *tls.Config) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.TLSConfig = config
+	}
+}
+
+func WithPassword(password string) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.Password = password
+	}
+}
+
+// WithDB selects the database after connecting, only for single-node and failover clients
+func WithDB(db int) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.DB = db
+	}
+}
+
+// WithMasterName connects to the master of the name through the sentinels given as addresses
+func WithMasterName(name string) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.MasterName = name
+	}
+}
+
+// WithCluster creates a cluster client even if only one seed address is given
+func WithCluster() Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.cluster = true
+	}
+}
+
+// WithTimeouts specifies the timeouts of dialing, reading and writing, 2s by default
+func WithTimeouts(dial, read, write time.Duration) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.DialTimeout = dial
+		cfg.options.ReadTimeout = read
+		cfg.options.WriteTimeout = write
+	}
+}
+
+// WithPoolSize specifies the maximum connections per node, 2 by default
+func WithPoolSize(size int) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.PoolSize = size
+	}
+}
+
+// WithPool specifies how the idle connections are kept and how long to wait for a busy pool
+func WithPool(minIdleConns int, idleTimeout, maxConnAge, poolTimeout time.Duration) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.MinIdleConns = minIdleConns
+		cfg.options.IdleTimeout = idleTimeout
+		cfg.options.MaxConnAge = maxConnAge
+		cfg.options.PoolTimeout = poolTimeout
+	}
+}
+
+// WithRetries specifies the retries of failed commands and the backoff between them
+func WithRetries(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.MaxRetries = maxRetries
+		cfg.options.MinRetryBackoff = minBackoff
+		cfg.options.MaxRetryBackoff = maxBackoff
+	}
+}
+
+// WithRouting specifies how the commands are routed in cluster:
+//	readOnly enables the read commands on slaves, and they're sent to the closest node
+//	if byLatency or a random one if randomly.
+func WithRouting(readOnly, byLatency, randomly bool) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.ReadOnly = readOnly
+		cfg.options.RouteByLatency = byLatency
+		cfg.options.RouteRandomly = randomly
+	}
+}
+
+// WithMaxRedirects specifies the retries following MOVED or ASK in cluster
+func WithMaxRedirects(redirects int) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.MaxRedirects = redirects
+	}
+}
+
+// WithOnConnect is called on every new connection
+func WithOnConnect(fn func(conn *goredis.Conn) error) Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.options.OnConnect = fn
+	}
+}
+
+// WithHashTags lays out keys as lock::{<namespace>::<key>} rather than lock::<namespace>::<key>,
+//	so all keys of a lock are in the same slot of cluster, which script locks require.
+//	All instances sharing the locks should use the same layout.
+func WithHashTags() Option {
+	return func(cfg *redisLockerConfig) {
+		cfg.hashTags = true
+	}
+}
+
+// WithUniversalOptions changes any of the options of client except the addresses
+func WithUniversalOptions(fn func(options *goredis.UniversalOptions)) Option {
+	return func(cfg *redisLockerConfig) {
+		fn(&cfg.options)
+	}
+}
+
+// clusterOptions is the same as the conversion in NewUniversalClient
+func clusterOptions(o *goredis.UniversalOptions) *goredis.ClusterOptions {
+	return &goredis.ClusterOptions{
+		Addrs:     o.Addrs,
+		OnConnect: o.OnConnect,
+		Password:  o.Password,
+
+		MaxRedirects:   o.MaxRedirects,
+		ReadOnly:       o.ReadOnly,
+		RouteByLatency: o.RouteByLatency,
+		RouteRandomly:  o.RouteRandomly,
+
+		MaxRetries:      o.MaxRetries,
+		MinRetryBackoff: o.MinRetryBackoff,
+		MaxRetryBackoff: o.MaxRetryBackoff,
+
+		DialTimeout:        o.DialTimeout,
+		ReadTimeout:        o.ReadTimeout,
+		WriteTimeout:       o.WriteTimeout,
+		PoolSize:           o.PoolSize,
+		MinIdleConns:       o.MinIdleConns,
+		MaxConnAge:         o.MaxConnAge,
+		PoolTimeout:        o.PoolTimeout,
+		IdleTimeout:        o.IdleTimeout,
+		IdleCheckFrequency: o.IdleCheckFrequency,
+
+		TLSConfig: o.TLSConfig,
+	}
+}
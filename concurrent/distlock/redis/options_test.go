@@ -0,0 +1,79 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions(t *testing.T) {
+	cfg := &redisLockerConfig{}
+	for _, fn := range []Option{
+		WithPassword("secret"),
+		WithDB(3),
+		WithMasterName("mymaster"),
+		WithTimeouts(time.Second, 2*time.Second, 3*time.Second),
+		WithPoolSize(20),
+		WithPool(5, time.Minute, time.Hour, 4*time.Second),
+		WithRetries(3, 10*time.Millisecond, time.Second),
+		WithRouting(true, true, false),
+		WithMaxRedirects(4),
+		WithUniversalOptions(func(o *goredis.UniversalOptions) {
+			o.IdleCheckFrequency = 30 * time.Second
+		}),
+	} {
+		fn(cfg)
+	}
+	assert.Equal(t, goredis.UniversalOptions{
+		Password:           "secret",
+		DB:                 3,
+		MasterName:         "mymaster",
+		DialTimeout:        time.Second,
+		ReadTimeout:        2 * time.Second,
+		WriteTimeout:       3 * time.Second,
+		PoolSize:           20,
+		MinIdleConns:       5,
+		IdleTimeout:        time.Minute,
+		MaxConnAge:         time.Hour,
+		PoolTimeout:        4 * time.Second,
+		MaxRetries:         3,
+		MinRetryBackoff:    10 * time.Millisecond,
+		MaxRetryBackoff:    time.Second,
+		ReadOnly:           true,
+		RouteByLatency:     true,
+		MaxRedirects:       4,
+		IdleCheckFrequency: 30 * time.Second,
+	}, cfg.options)
+}
+
+func TestClientType(t *testing.T) {
+	locker, _ := NewWithOptions([]string{"127.0.0.1:6379"})
+	assert.IsType(t, &goredis.Client{}, locker.client)
+	locker.Close()
+
+	locker, _ = NewWithOptions([]string{"127.0.0.1:7000"}, WithCluster())
+	assert.IsType(t, &goredis.ClusterClient{}, locker.client)
+	locker.Close()
+
+	locker, _ = NewWithOptions([]string{"127.0.0.1:7000", "127.0.0.1:7001"})
+	assert.IsType(t, &goredis.ClusterClient{}, locker.client)
+	locker.Close()
+}
+
+func TestNewWithClient(t *testing.T) {
+	client := goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:6379"})
+	locker := NewWithClient(client)
+	storetest.DoTest(t, locker)
+
+	// still usable after locker is closed
+	locker.Close()
+	assert.NoError(t, client.Ping().Err())
+	client.Close()
+}
@@ -1,26 +1,86 @@
 package redis
 
 import (
+	"strings"
+	"sync"
 	"time"
 
 	goredis "github.com/go-redis/redis"
 	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
 )
 
+// compareAndSwapScript sets KEYS[1] to ARGV[2] with ARGV[3] milliseconds expiration
+//	when its current value equals ARGV[1] (empty for absent)
+var compareAndSwapScript = goredis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if (cur == false and ARGV[1] == '') or cur == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// globEscaper escapes the special characters of pattern in SCAN
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 type RedisLocker struct {
-	client  goredis.UniversalClient
-	stopped bool
+	client goredis.UniversalClient
+	// owned is true if the client is created by locker
+	owned    bool
+	hashTags bool
+	stopped  bool
 }
 
 func New(addrs []string) *RedisLocker {
-	return &RedisLocker{
-		client: goredis.NewUniversalClient(&goredis.UniversalOptions{
-			Addrs:        addrs,
+	locker, _ := NewWithOptions(addrs)
+	return locker
+}
+
+// NewWithOptions works like {New} but accepts options and returns the error of them
+func NewWithOptions(addrs []string, opts ...Option) (*RedisLocker, error) {
+	lockerConfig := &redisLockerConfig{
+		options: goredis.UniversalOptions{
 			PoolSize:     2,
 			DialTimeout:  2 * time.Second,
 			ReadTimeout:  2 * time.Second,
 			WriteTimeout: 2 * time.Second,
-		}),
+		},
+	}
+	for _, fn := range opts {
+		fn(lockerConfig)
+	}
+	options := lockerConfig.options
+	options.Addrs = addrs
+	if lockerConfig.tls != nil {
+		tlsConfig, err := lockerConfig.tls.Build()
+		if err != nil {
+			return nil, err
+		}
+		options.TLSConfig = tlsConfig
+	}
+	var client goredis.UniversalClient
+	if lockerConfig.cluster && options.MasterName == "" {
+		client = goredis.NewClusterClient(clusterOptions(&options))
+	} else {
+		client = goredis.NewUniversalClient(&options)
+	}
+	return &RedisLocker{
+		client:   client,
+		owned:    true,
+		hashTags: lockerConfig.hashTags,
+	}, nil
+}
+
+// NewWithClient reuses an existing client, which is left open when the locker is closed.
+//	The options of client are ignored.
+func NewWithClient(client goredis.UniversalClient, opts ...Option) *RedisLocker {
+	lockerConfig := &redisLockerConfig{}
+	for _, fn := range opts {
+		fn(lockerConfig)
+	}
+	return &RedisLocker{
+		client:   client,
+		hashTags: lockerConfig.hashTags,
 	}
 }
 
@@ -32,36 +92,117 @@ func (r *RedisLocker) check() {
 
 func (r *RedisLocker) Keep(lockKey *distlock.LockKey, val string, expire time.Duration) {
 	r.check()
-	r.client.Set(lockKey.String(), val, expire)
+	r.client.Set(r.key(lockKey), val, expire)
 }
 
 func (r *RedisLocker) Exists(lockKey *distlock.LockKey) bool {
 	r.check()
-	return r.client.Exists(lockKey.String()).Val() > 0
+	return r.client.Exists(r.key(lockKey)).Val() > 0
 }
 
 func (r *RedisLocker) Get(lockKey *distlock.LockKey) string {
 	r.check()
-	return r.client.Get(lockKey.String()).Val()
+	return r.client.Get(r.key(lockKey)).Val()
 }
 
 func (r *RedisLocker) Set(lockKey *distlock.LockKey, val string, expire time.Duration) {
 	r.check()
-	r.client.Set(lockKey.String(), val, expire)
+	r.client.Set(r.key(lockKey), val, expire)
 }
 
 func (r *RedisLocker) SetIfAbsent(lockKey *distlock.LockKey, val string, expire time.Duration) bool {
 	r.check()
-	return r.client.SetNX(lockKey.String(), val, expire).Val()
+	return r.client.SetNX(r.key(lockKey), val, expire).Val()
+}
+
+func (r *RedisLocker) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	r.check()
+	millis := int64(expire / time.Millisecond)
+	if millis < 1 {
+		millis = 1
+	}
+	result, _ := compareAndSwapScript.Run(r.client, []string{r.key(lockKey)}, old, val, millis).Int64()
+	return result == 1
 }
 
 func (r *RedisLocker) Delete(lockKey *distlock.LockKey) {
 	r.check()
-	r.client.Del(lockKey.String())
+	r.client.Del(r.key(lockKey))
+}
+
+// scan returns the keys matching pattern, from every master if it's a cluster
+func (r *RedisLocker) scan(pattern string) ([]string, error) {
+	var (
+		mutex sync.Mutex
+		keys  []string
+	)
+	fn := func(client goredis.Cmdable) error {
+		iter := client.Scan(0, pattern, 100).Iterator()
+		for iter.Next() {
+			mutex.Lock()
+			keys = append(keys, iter.Val())
+			mutex.Unlock()
+		}
+		return iter.Err()
+	}
+	if cluster, ok := r.client.(*goredis.ClusterClient); ok {
+		err := cluster.ForEachMaster(func(client *goredis.Client) error {
+			return fn(client)
+		})
+		return keys, err
+	}
+	return keys, fn(r.client)
+}
+
+func (r *RedisLocker) List(namespace string) ([]distlock.Entry, error) {
+	r.check()
+	keys, err := r.scan(r.keyPattern(namespace))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]distlock.Entry, 0, len(keys))
+	for _, key := range keys {
+		k, ok := r.keyOf(namespace, key)
+		if !ok {
+			continue
+		}
+		val, err := r.client.Get(key).Result()
+		if err == goredis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := r.client.PTTL(key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ttl == -2*time.Millisecond {
+			// expired just now
+			continue
+		}
+		if ttl < 0 {
+			// never expires
+			ttl = 0
+		}
+		entries = append(entries, distlock.Entry{
+			LockKey: distlock.LockKey{Namespace: namespace, Key: k},
+			Value:   val,
+			TTL:     ttl,
+		})
+	}
+	return entries, nil
+}
+
+func (r *RedisLocker) Ping() error {
+	r.check()
+	return r.client.Ping().Err()
 }
 
 func (r *RedisLocker) Close() {
 	r.check()
 	r.stopped = true
-	r.client.Close()
+	if r.owned {
+		r.client.Close()
+	}
 }
@@ -4,8 +4,16 @@ import (
 	"testing"
 
 	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRedis(t *testing.T) {
 	storetest.DoTest(t, New([]string{"127.0.0.1:6379"}))
 }
+
+func TestRedisHashTags(t *testing.T) {
+	locker, err := NewWithOptions([]string{"127.0.0.1:6379"}, WithHashTags())
+	assert.NoError(t, err)
+	storetest.DoTest(t, locker)
+	locker.Close()
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/strutils"
+	"github.com/sirupsen/logrus"
+)
+
+// Structure: lock::{<namespace>-script::<key>} => hash of {owner: hold count}
+//	Nothing else is kept, so the lock leaves no key behind when it's released or expired.
+
+// NAMESPACE_SUFFIX separates the keys of script locks from the string ones of store
+const NAMESPACE_SUFFIX = "-script"
+
+// acquireScript holds KEYS[1] for ARGV[1] with ARGV[2] milliseconds expiration, or increases
+//	the hold count if it's held by ARGV[1] already and ARGV[3] is '1'.
+//	Returns the hold count or 0 for failure.
+var acquireScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('HSET', KEYS[1], ARGV[1], 1)
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if ARGV[3] == '1' and redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	local count = redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return count
+end
+return 0
+`)
+
+// renewScript resets the expiration of KEYS[1] to ARGV[2] milliseconds if it's held by ARGV[1]
+var renewScript = goredis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// releaseScript decreases the count of KEYS[1] held by ARGV[1], or clears it if ARGV[3] is '1',
+//	and removes the key when the count reaches 0. Returns the count left or -1 if not held.
+var releaseScript = goredis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return -1
+end
+local count = 0
+if ARGV[3] ~= '1' then
+	count = redis.call('HINCRBY', KEYS[1], ARGV[1], -1)
+end
+if count > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return count
+end
+redis.call('DEL', KEYS[1])
+return 0
+`)
+
+// ScriptLock is a redis native lock whose acquiring, renewing and releasing are done in a
+//	single script each, by EVALSHA and falling back to EVAL if the script isn't cached.
+//	The hold count of reentry lock is kept in the hash of key.
+type ScriptLock struct {
+	locker    *RedisLocker
+	namespace string
+	uuid      string
+	expire    time.Duration
+	reentry   bool
+	encoder   distlock.KeyEncoder
+	mutex     sync.Mutex
+	// keys held by myself
+	holdings map[string]bool
+}
+
+// NewScriptMutex returns a non-reentry lock sharing the client of locker
+func NewScriptMutex(namespace string, expire time.Duration, locker *RedisLocker) distlock.DistLock {
+	return newScriptLock(namespace, expire, locker, false)
+}
+
+// NewScriptReentry returns a reentry lock sharing the client of locker
+func NewScriptReentry(namespace string, expire time.Duration, locker *RedisLocker) distlock.DistLock {
+	return newScriptLock(namespace, expire, locker, true)
+}
+
+func newScriptLock(namespace string, expire time.Duration, locker *RedisLocker, reentry bool) *ScriptLock {
+	if namespace == "" {
+		namespace = "distributed-lock"
+	}
+	return &ScriptLock{
+		locker:    locker,
+		namespace: namespace,
+		uuid:      strutils.RandString(20),
+		expire:    expire,
+		reentry:   reentry,
+		holdings:  make(map[string]bool),
+	}
+}
+
+// OwnerID returns the field of myself in the hash of locks
+func (l *ScriptLock) OwnerID() string {
+	return l.uuid
+}
+
+// SetKeyEncoder changes how targets are encoded into keys, distlock.DefaultKeyEncoder by default.
+//	It should be the same for all owners of a namespace.
+func (l *ScriptLock) SetKeyEncoder(encoder distlock.KeyEncoder) {
+	l.encoder = encoder
+}
+
+func (l *ScriptLock) key(target interface{}) (string, error) {
+	l.locker.check()
+	lockKey, err := distlock.NewLockKey(l.locker, l.encoder, l.namespace+NAMESPACE_SUFFIX, target)
+	if err != nil {
+		return "", err
+	}
+	// tagged whatever the layout of locker is, so keys added for the lock share its slot
+	return hashTagKey(lockKey), nil
+}
+
+func (l *ScriptLock) millis() int64 {
+	millis := int64(l.expire / time.Millisecond)
+	if millis < 1 {
+		millis = 1
+	}
+	return millis
+}
+
+// run executes script on the key with ARGV of owner, expiration and flag
+func (l *ScriptLock) run(script *goredis.Script, key string, flag bool) *goredis.Cmd {
+	arg := "0"
+	if flag {
+		arg = "1"
+	}
+	return script.Run(l.locker.client, []string{key}, l.uuid, l.millis(), arg)
+}
+
+func (l *ScriptLock) TryLock(target interface{}) bool {
+	key, err := l.key(target)
+	if err != nil {
+		logrus.Warn("Failed to lock ", target, ": ", err.Error())
+		return false
+	}
+	count, err := l.run(acquireScript, key, l.reentry).Int64()
+	if err != nil {
+		logrus.Warn("Failed to lock ", target, ": ", err.Error())
+		return false
+	}
+	if count < 1 {
+		return false
+	}
+	l.mutex.Lock()
+	l.holdings[key] = true
+	l.mutex.Unlock()
+	return true
+}
+
+// Lock tries to lock every distlock.TRY_INTERVAL in {wait} time or returns a LockFailed error
+func (l *ScriptLock) Lock(target interface{}, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	for {
+		if l.TryLock(target) {
+			return nil
+		}
+		if time.Now().Add(distlock.TRY_INTERVAL).After(deadline) {
+			return distlock.LockFailed
+		}
+		time.Sleep(distlock.TRY_INTERVAL)
+	}
+}
+
+func (l *ScriptLock) Keep(target interface{}) {
+	key, err := l.key(target)
+	if err != nil {
+		logrus.Warn("Failed to renew lock of ", target, ": ", err.Error())
+		return
+	}
+	renewed, err := l.run(renewScript, key, false).Int64()
+	if err != nil {
+		logrus.Warn("Failed to renew lock of ", target, ": ", err.Error())
+		return
+	}
+	if renewed < 1 {
+		logrus.Warn("Lock of ", target, " has been lost")
+		l.mutex.Lock()
+		delete(l.holdings, key)
+		l.mutex.Unlock()
+	}
+}
+
+func (l *ScriptLock) UnLock(target interface{}) bool {
+	key, err := l.key(target)
+	if err != nil {
+		logrus.Warn("Failed to unlock ", target, ": ", err.Error())
+		return false
+	}
+	count, err := l.run(releaseScript, key, false).Int64()
+	if err != nil {
+		logrus.Warn("Failed to unlock ", target, ": ", err.Error())
+		return false
+	}
+	if count < 1 {
+		l.mutex.Lock()
+		delete(l.holdings, key)
+		l.mutex.Unlock()
+	}
+	return count >= 0
+}
+
+// Close releases all locks held but leaves the client of locker open
+func (l *ScriptLock) Close() {
+	l.mutex.Lock()
+	holdings := l.holdings
+	l.holdings = make(map[string]bool)
+	l.mutex.Unlock()
+	for key := range holdings {
+		if err := l.run(releaseScript, key, true).Err(); err != nil {
+			logrus.Warn("Failed to release ", key, ": ", err.Error())
+		}
+	}
+}
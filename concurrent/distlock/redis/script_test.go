@@ -0,0 +1,91 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptMutex(t *testing.T) {
+	store := New([]string{"127.0.0.1:6379"})
+	lock1 := NewScriptMutex("testns", 2*time.Second, store)
+	lock2 := NewScriptMutex("testns", 2*time.Second, store)
+	id := 1111
+
+	assert.True(t, lock1.TryLock(id))
+	assert.False(t, lock1.TryLock(id))
+	assert.False(t, lock2.TryLock(id))
+	assert.Equal(t, distlock.LockFailed, lock2.Lock(id, 200*time.Millisecond))
+	assert.False(t, lock2.UnLock(id))
+	assert.True(t, lock1.UnLock(id))
+	assert.False(t, lock1.UnLock(id))
+	assert.NoError(t, lock2.Lock(id, time.Second))
+
+	// expired without renewing
+	time.Sleep(1500 * time.Millisecond)
+	lock2.Keep(id)
+	time.Sleep(1500 * time.Millisecond)
+	assert.False(t, lock1.TryLock(id))
+	time.Sleep(time.Second)
+	assert.True(t, lock1.TryLock(id))
+	lock2.Keep(id)
+	assert.False(t, lock2.UnLock(id))
+
+	lock1.Close()
+	assert.True(t, lock2.TryLock(id))
+	lock2.Close()
+	store.Close()
+}
+
+func TestScriptReentry(t *testing.T) {
+	store := New([]string{"127.0.0.1:6379"})
+	lock1 := NewScriptReentry("testns", 2*time.Second, store)
+	lock2 := NewScriptReentry("testns", 2*time.Second, store)
+	id := 2222
+	key, err := lock1.(*ScriptLock).key(id)
+	assert.NoError(t, err)
+
+	assert.True(t, lock1.TryLock(id))
+	assert.NoError(t, lock1.Lock(id, time.Second))
+	assert.Equal(t, "2", store.client.HGet(key, lock1.(*ScriptLock).OwnerID()).Val())
+	assert.False(t, lock2.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+	assert.False(t, lock2.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+	assert.Equal(t, int64(0), store.client.Exists(key).Val())
+	assert.True(t, lock2.TryLock(id))
+	assert.True(t, lock2.TryLock(id))
+	// nothing is left after released
+	lock2.UnLock(id)
+	lock2.UnLock(id)
+	assert.Equal(t, int64(0), store.client.Exists(key).Val())
+	assert.True(t, lock2.TryLock(id))
+
+	// released whatever the count is
+	lock2.Close()
+	assert.True(t, lock1.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+	lock1.Close()
+	store.Close()
+}
+
+func TestScriptNotCached(t *testing.T) {
+	store := New([]string{"127.0.0.1:6379"})
+	lock := NewScriptMutex("testns", 2*time.Second, store)
+	id := 3333
+
+	assert.NoError(t, store.client.ScriptFlush().Err())
+	assert.True(t, lock.TryLock(id))
+	assert.NoError(t, store.client.ScriptFlush().Err())
+	lock.Keep(id)
+	assert.NoError(t, store.client.ScriptFlush().Err())
+	assert.True(t, lock.UnLock(id))
+	lock.Close()
+	store.Close()
+}
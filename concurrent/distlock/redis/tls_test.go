@@ -0,0 +1,59 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// pong answers every command with PONG
+func pong(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+		// bulk strings in pairs of length and content
+		for i := 0; i < n*2; i++ {
+			if _, err := reader.ReadString('\n'); err != nil {
+				return
+			}
+		}
+		conn.Write([]byte("+PONG\r\n"))
+	}
+}
+
+func TestTLS(t *testing.T) {
+	f := storetest.NewTLSFixture(t)
+	addr, clients := f.Serve(t, pong)
+
+	locker, err := NewWithOptions([]string{addr}, WithTLS(f.Config()))
+	assert.NoError(t, err)
+	assert.NoError(t, locker.Ping())
+	assert.Equal(t, "client", <-clients)
+	locker.Close()
+
+	// server isn't trusted
+	locker, _ = NewWithOptions([]string{addr}, WithTLS(distlock.TLSConfig{
+		CertFile: f.CertFile,
+		KeyFile:  f.KeyFile,
+	}))
+	assert.Error(t, locker.Ping())
+	locker.Close()
+
+	_, err = NewWithOptions([]string{addr}, WithTLS(distlock.TLSConfig{CAFile: f.Dir + "/absent.pem"}))
+	assert.Error(t, err)
+}
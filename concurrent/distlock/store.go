@@ -5,6 +5,7 @@
 package distlock
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -32,3 +33,74 @@ type Store interface {
 	Delete(lockKey *LockKey)
 	Close()
 }
+
+// AtomicStore is implemented by stores which can replace a value atomically
+type AtomicStore interface {
+	Store
+	// CompareAndSwap replaces the content with val only when the current content equals old and
+	//	returns true for success. An empty old stands for an absent key.
+	CompareAndSwap(lockKey *LockKey, old, val string, expire time.Duration) bool
+}
+
+// Renewer is implemented by stores which expire keys by themselves and can extend the
+//	expiration of a key without rewriting it, eg. by the lease of etcdv3. Locks in such
+//	stores keep the time they were written, and they're valid as long as they exist,
+//	so {ErrHeld} of them can't tell the remaining time.
+type Renewer interface {
+	// Renew extends the expiration of key without writing if val was written with the same
+	//	expiration by current store lastly, and returns false if it can't.
+	Renew(lockKey *LockKey, val string, expire time.Duration) bool
+}
+
+// Pinger is implemented by stores which can check the availability of backend
+type Pinger interface {
+	// Ping returns nil if the backend is reachable
+	Ping() error
+}
+
+// WatchStore is implemented by stores which can notify the changes of a key
+type WatchStore interface {
+	Store
+	// Watch returns a channel signaled whenever the content of the key changes.
+	//	The channel is closed after ctx is done.
+	Watch(ctx context.Context, lockKey *LockKey) <-chan struct{}
+}
+
+// ValueLimiter is implemented by stores which can't hold values longer than a limit,
+//	eg. the column of database.
+type ValueLimiter interface {
+	// MaxValueLength returns the maximum length in bytes of values, 0 for unlimited
+	MaxValueLength() int
+}
+
+// checkValue returns ErrValueTooLong if val exceeds the limit of store
+func checkValue(store Store, val string) error {
+	if limiter, ok := store.(ValueLimiter); ok {
+		if max := limiter.MaxValueLength(); max > 0 && len(val) > max {
+			return fmt.Errorf("%w: %d bytes exceeds %d", ErrValueTooLong, len(val), max)
+		}
+	}
+	return nil
+}
+
+// LossNotifier is implemented by stores which may lose locks without being released,
+//	eg. the ephemeral nodes of an expired zookeeper session.
+type LossNotifier interface {
+	// OnLost registers a handler called with the key of every lock lost,
+	//	and returns a function to unregister it.
+	OnLost(handler func(lockKey *LockKey)) (cancel func())
+}
+
+// Entry is a lock stored along with its remaining time to live
+type Entry struct {
+	LockKey LockKey
+	Value   string
+	// TTL is zero if the lock never expires
+	TTL time.Duration
+}
+
+// Lister is implemented by stores which can enumerate the locks of a namespace
+type Lister interface {
+	// List returns the locks alive in namespace with their remaining TTL
+	List(namespace string) ([]Entry, error)
+}
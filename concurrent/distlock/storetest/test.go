@@ -1,6 +1,12 @@
 package storetest
 
 import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -9,7 +15,7 @@ import (
 )
 
 func DoTest(t *testing.T, s distlock.Store) {
-	key := &distlock.LockKey{"testns", "demo"}
+	key := &distlock.LockKey{Namespace: "testns", Key: "demo"}
 	expire := time.Second * 2
 	s.Delete(key)
 
@@ -39,8 +45,134 @@ func DoTest(t *testing.T, s distlock.Store) {
 	time.Sleep(time.Second)
 	assert.False(t, s.Exists(key))
 
+	if atomic, ok := s.(distlock.AtomicStore); ok {
+		DoTestCompareAndSwap(t, atomic)
+		DoTestBarrier(t, atomic)
+		DoTestCountDownLatch(t, atomic)
+		DoTestTransfer(t, atomic)
+	}
 	DoTestMutex(t, s)
 	DoTestReentry(t, s)
+	DoTestOnce(t, s)
+	DoTestErrors(t, s)
+	DoTestOptions(t, s)
+	DoTestKeyEncoder(t, s)
+	if _, ok := s.(distlock.Lister); ok {
+		DoTestList(t, s)
+	}
+	if watcher, ok := s.(distlock.WatchStore); ok {
+		DoTestWatch(t, watcher)
+	}
+	if _, ok := s.(distlock.ValueLimiter); ok {
+		DoTestValueLimit(t, s)
+	}
+}
+
+func DoTestWatch(t *testing.T, s distlock.WatchStore) {
+	key := &distlock.LockKey{Namespace: "testns", Key: "watch"}
+	s.Delete(key)
+	ctx, cancel := context.WithCancel(context.Background())
+	changed := s.Watch(ctx, key)
+	received := func() bool {
+		select {
+		case _, ok := <-changed:
+			return ok
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+
+	// creation, change and deletion
+	time.Sleep(100 * time.Millisecond)
+	s.Set(key, "a", 2*time.Second)
+	assert.True(t, received())
+	time.Sleep(100 * time.Millisecond)
+	s.Set(key, "b", 2*time.Second)
+	assert.True(t, received())
+	time.Sleep(100 * time.Millisecond)
+	s.Delete(key)
+	assert.True(t, received())
+
+	// closed after ctx is done
+	cancel()
+	closed := make(chan struct{})
+	go func() {
+		for range changed {
+		}
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Error("Channel of watch isn't closed")
+	}
+}
+
+func DoTestValueLimit(t *testing.T, s distlock.Store) {
+	max := s.(distlock.ValueLimiter).MaxValueLength()
+	if max == 0 {
+		return
+	}
+	long := func() (string, error) {
+		return strings.Repeat("a", max), nil
+	}
+	_, err := distlock.NewOnceGroup("testns", s).Once(context.Background(), "long", 2*time.Second, long)
+	assert.True(t, errors.Is(err, distlock.ErrValueTooLong))
+	_, shared := distlock.NewOnceGroup("testns", s).Once(context.Background(), "long", 2*time.Second, long)
+	assert.EqualError(t, shared, err.Error())
+
+	// metadata making lock data too long
+	lock := distlock.NewMutex("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+	metadata := distlock.WithMetadata(strings.Repeat("a", max))
+	assert.True(t, errors.Is(lock.LockWith("long", metadata), distlock.ErrValueTooLong))
+	assert.False(t, lock.TryLockWith("long", metadata))
+	assert.True(t, lock.TryLockWith("long", distlock.WithMetadata("short")))
+	assert.True(t, errors.Is(lock.Renew("long", metadata), distlock.ErrValueTooLong))
+	if info, err := lock.Inspect("long"); assert.NoError(t, err) {
+		assert.Equal(t, "short", info.Metadata)
+	}
+	assert.True(t, lock.UnLock("long"))
+
+	atomicStore, ok := s.(distlock.AtomicStore)
+	if !ok {
+		return
+	}
+	// the state of barrier grows with participants
+	s.Delete(&distlock.LockKey{Namespace: "testns", Key: "barrier::long"})
+	b := distlock.NewBarrier("testns", "long", max, atomicStore, distlock.WithSyncExpire(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	var tooLong int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < max/20+1; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.Wait(ctx); errors.Is(err, distlock.ErrValueTooLong) {
+				atomic.AddInt32(&tooLong, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.True(t, tooLong > 0)
+}
+
+func DoTestCompareAndSwap(t *testing.T, s distlock.AtomicStore) {
+	key := &distlock.LockKey{Namespace: "testns", Key: "cas"}
+	expire := time.Second * 2
+	s.Delete(key)
+
+	assert.False(t, s.CompareAndSwap(key, "t0", "t1", expire))
+	assert.False(t, s.Exists(key))
+	assert.True(t, s.CompareAndSwap(key, "", "t1", expire))
+	assert.Equal(t, "t1", s.Get(key))
+	assert.False(t, s.CompareAndSwap(key, "", "t2", expire))
+	assert.False(t, s.CompareAndSwap(key, "t0", "t2", expire))
+	assert.Equal(t, "t1", s.Get(key))
+	assert.True(t, s.CompareAndSwap(key, "t1", "t2", expire))
+	assert.Equal(t, "t2", s.Get(key))
+	s.Delete(key)
+	assert.False(t, s.Exists(key))
 }
 
 func DoTestMutex(t *testing.T, s distlock.Store) {
@@ -93,3 +225,377 @@ func DoTestReentry(t *testing.T, s distlock.Store) {
 	assert.Error(t, lock1.Lock(id, 1500*time.Millisecond))
 	assert.True(t, lock.UnLock(id))
 }
+
+func DoTestOnce(t *testing.T, s distlock.Store) {
+	g1 := distlock.NewOnceGroup("testns", s)
+	g2 := distlock.NewOnceGroup("testns", s)
+	var executed int32
+	fn := func() (string, error) {
+		atomic.AddInt32(&executed, 1)
+		time.Sleep(200 * time.Millisecond)
+		return "result", nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		g := g1
+		if i%2 == 1 {
+			g = g2
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := g.Once(context.Background(), 5555, 2*time.Second, fn)
+			assert.NoError(t, err)
+			assert.Equal(t, "result", val)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), executed)
+
+	// error is shared as well
+	failed := errors.New("failed")
+	_, err := g1.Once(context.Background(), 6666, 2*time.Second, func() (string, error) { return "", failed })
+	assert.Equal(t, failed, err)
+	_, err = g2.Once(context.Background(), 6666, 2*time.Second, fn)
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, int32(1), executed)
+
+	// result expires
+	time.Sleep(2 * time.Second)
+	val, err := g2.Once(context.Background(), 5555, 2*time.Second, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "result", val)
+	assert.Equal(t, int32(2), executed)
+
+	// the lock is released if fn panics
+	assert.Panics(t, func() {
+		g1.Once(context.Background(), 7777, 2*time.Second, func() (string, error) { panic("failed") })
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	val, err = g2.Once(ctx, 7777, 2*time.Second, fn)
+	cancel()
+	assert.NoError(t, err)
+	assert.Equal(t, "result", val)
+	assert.Equal(t, int32(3), executed)
+
+	// waiting goroutines take over if the one talking to store quits
+	slow := func() (string, error) {
+		atomic.AddInt32(&executed, 1)
+		time.Sleep(500 * time.Millisecond)
+		return "slow", nil
+	}
+	go g2.Once(context.Background(), 8888, 2*time.Second, slow)
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := g1.Once(ctx, 8888, 2*time.Second, fn)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	val, err = g1.Once(context.Background(), 8888, 2*time.Second, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", val)
+	wg.Wait()
+	assert.Equal(t, int32(4), executed)
+
+	// the lock is renewed while fn runs longer than ttl
+	go g1.Once(context.Background(), 9999, 300*time.Millisecond, func() (string, error) {
+		time.Sleep(500 * time.Millisecond)
+		return slow()
+	})
+	time.Sleep(500 * time.Millisecond)
+	val, err = g2.Once(context.Background(), 9999, 300*time.Millisecond, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", val)
+	assert.Equal(t, int32(5), executed)
+
+	// the package function shares results with the default group
+	distlock.SetDefaultOnceGroup(g2)
+	defer distlock.SetDefaultOnceGroup(nil)
+	val, err = distlock.Once(context.Background(), 4444, 2*time.Second, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "result", val)
+	val, err = g1.Once(context.Background(), 4444, 2*time.Second, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "result", val)
+	assert.Equal(t, int32(6), executed)
+}
+
+func DoTestBarrier(t *testing.T, s distlock.AtomicStore) {
+	s.Delete(&distlock.LockKey{Namespace: "testns", Key: "barrier::demo"})
+	b1 := distlock.NewBarrier("testns", "demo", 3, s, distlock.WithSyncExpire(time.Second))
+	b2 := distlock.NewBarrier("testns", "demo", 3, s, distlock.WithSyncExpire(time.Second))
+
+	// abandoned participant
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, b1.Wait(ctx))
+	cancel()
+	assert.Equal(t, 0, b1.Waiting())
+
+	for round := 0; round < 2; round++ {
+		var passed int32
+		wg := sync.WaitGroup{}
+		for i := 0; i < 3; i++ {
+			b := b1
+			if i%2 == 1 {
+				b = b2
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, b.Wait(context.Background()))
+				atomic.AddInt32(&passed, 1)
+			}()
+			time.Sleep(100 * time.Millisecond)
+			if i < 2 {
+				assert.Equal(t, int32(0), atomic.LoadInt32(&passed))
+				assert.Equal(t, i+1, b1.Waiting())
+			}
+		}
+		wg.Wait()
+		assert.Equal(t, int32(3), passed)
+	}
+}
+
+func DoTestCountDownLatch(t *testing.T, s distlock.AtomicStore) {
+	s.Delete(&distlock.LockKey{Namespace: "testns", Key: "latch::demo"})
+	latch := distlock.NewCountDownLatch("testns", "demo", 2, s, distlock.WithSyncExpire(time.Second))
+	assert.Equal(t, 2, latch.Count())
+	latch1 := distlock.NewCountDownLatch("testns", "demo", 5, s, distlock.WithSyncExpire(time.Second))
+	assert.Equal(t, 2, latch1.Count())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, latch.Wait(ctx))
+	cancel()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, latch.CountDown())
+		assert.NoError(t, latch1.CountDown())
+	}()
+	assert.NoError(t, latch1.Wait(context.Background()))
+	assert.Equal(t, 0, latch.Count())
+	assert.NoError(t, latch.CountDown())
+	assert.Equal(t, 0, latch.Count())
+
+	// abandoned
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, distlock.SyncExpired, latch.Wait(context.Background()))
+	assert.Equal(t, distlock.SyncExpired, latch.CountDown())
+}
+
+func DoTestTransfer(t *testing.T, s distlock.AtomicStore) {
+	lock := distlock.NewMutex("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+	lock1 := distlock.NewMutex("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+	id := 7777
+
+	assert.False(t, lock.Transfer(id, lock1.OwnerID()))
+	assert.True(t, lock.TryLock(id))
+	assert.False(t, lock1.Adopt(id))
+	assert.False(t, lock1.Transfer(id, lock.OwnerID()))
+	assert.True(t, lock.Transfer(id, lock1.OwnerID()))
+	assert.False(t, lock.TryLock(id))
+	assert.False(t, lock.UnLock(id))
+	assert.True(t, lock1.Adopt(id))
+	assert.False(t, lock1.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+	assert.True(t, lock.TryLock(id))
+	assert.True(t, lock.UnLock(id))
+
+	// the old owner goes to store rather than its local state
+	assert.True(t, lock.TryLock(id))
+	assert.True(t, lock.Transfer(id, lock1.OwnerID()))
+	assert.True(t, lock1.Adopt(id))
+	assert.True(t, lock1.UnLock(id))
+	assert.True(t, lock.TryLock(id))
+	assert.True(t, lock.UnLock(id))
+
+	reentry := distlock.NewReentry("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+	reentry1 := distlock.NewReentry("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+	assert.True(t, reentry.TryLock(id))
+	assert.True(t, reentry.Transfer(id, reentry1.OwnerID()))
+	assert.True(t, reentry1.Adopt(id))
+	assert.False(t, reentry.TryLock(id))
+	if info, err := reentry.Inspect(id); assert.NoError(t, err) {
+		assert.Equal(t, reentry1.OwnerID(), info.Owner)
+	}
+	assert.True(t, reentry1.UnLock(id))
+	assert.True(t, reentry.TryLock(id))
+	assert.True(t, reentry.UnLock(id))
+}
+
+func DoTestErrors(t *testing.T, s distlock.Store) {
+	lock := distlock.NewMutex("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+	lock1 := distlock.NewMutex("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+	id := 8888
+
+	assert.Equal(t, distlock.ErrNotOwner, lock.Release(id))
+	assert.Equal(t, distlock.ErrNotOwner, lock.Renew(id))
+	assert.NoError(t, lock.TryAcquire(id))
+
+	err := lock1.TryAcquire(id)
+	var held *distlock.ErrHeld
+	assert.True(t, errors.As(err, &held))
+	assert.True(t, errors.Is(err, distlock.LockFailed))
+	assert.Equal(t, lock.OwnerID(), held.Owner)
+	if _, ok := s.(distlock.Renewer); ok {
+		// unknown
+		assert.Equal(t, time.Duration(0), held.Remaining)
+	} else {
+		assert.True(t, held.Remaining > time.Second)
+		assert.True(t, held.Remaining <= 2*time.Second)
+	}
+	assert.Equal(t, distlock.ErrNotOwner, lock1.Release(id))
+	assert.Equal(t, distlock.ErrNotOwner, lock1.Renew(id))
+	assert.Equal(t, distlock.ErrTimeout, lock1.Acquire(id, 100*time.Millisecond))
+	assert.True(t, errors.Is(distlock.ErrTimeout, distlock.LockFailed))
+
+	assert.NoError(t, lock.Renew(id))
+	assert.NoError(t, lock.Release(id))
+	assert.NoError(t, lock1.Acquire(id, 100*time.Millisecond))
+	assert.NoError(t, lock1.Release(id))
+}
+
+func DoTestOptions(t *testing.T, s distlock.Store) {
+	lock := distlock.NewMutex("testns", 10*time.Second, s).(*distlock.DistLockImpl)
+	lock1 := distlock.NewMutex("testns", 10*time.Second, s).(*distlock.DistLockImpl)
+	id := 9999
+
+	assert.True(t, lock.TryLockWith(id, distlock.WithTTL(time.Second), distlock.WithMetadata("host|1")))
+	info, err := lock1.Inspect(id)
+	assert.NoError(t, err)
+	assert.Equal(t, lock.OwnerID(), info.Owner)
+	assert.Equal(t, time.Second, info.TTL)
+	assert.Equal(t, "host|1", info.Metadata)
+	var held *distlock.ErrHeld
+	assert.True(t, errors.As(lock1.TryAcquire(id), &held))
+	assert.Equal(t, "host|1", held.Metadata)
+	assert.True(t, held.Remaining <= time.Second)
+	assert.True(t, errors.As(lock1.LockWith(id), &held))
+	assert.True(t, errors.Is(lock1.LockWith(id), distlock.LockFailed))
+
+	// ttl and metadata are kept when renewing
+	assert.NoError(t, lock.Renew(id))
+	info, _ = lock1.Inspect(id)
+	assert.Equal(t, time.Second, info.TTL)
+	assert.Equal(t, "host|1", info.Metadata)
+
+	// expires in ttl rather than the default expiration
+	start := time.Now()
+	assert.Equal(t, distlock.ErrTimeout, lock1.LockWith(id, distlock.WithWait(100*time.Millisecond)))
+	assert.NoError(t, lock1.LockWith(id, distlock.WithWait(3*time.Second), distlock.WithRetry(50*time.Millisecond)))
+	assert.True(t, time.Since(start) > 500*time.Millisecond)
+	assert.True(t, time.Since(start) < 2*time.Second)
+	info, _ = lock.Inspect(id)
+	assert.Equal(t, lock1.OwnerID(), info.Owner)
+	assert.Equal(t, "", info.Metadata)
+
+	// overridden when renewing
+	lock1.KeepWith(id, distlock.WithTTL(5*time.Second))
+	info, _ = lock.Inspect(id)
+	assert.Equal(t, 5*time.Second, info.TTL)
+	assert.NoError(t, lock1.Release(id))
+	info, err = lock.Inspect(id)
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func DoTestKeyEncoder(t *testing.T, s distlock.Store) {
+	lock := distlock.NewMutex("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+	lock1 := distlock.NewMutex("testns", 2*time.Second, s).(*distlock.DistLockImpl)
+
+	// targets with the same print form collide by default
+	assert.True(t, lock.TryLock(7777))
+	assert.False(t, lock1.TryLock("7777"))
+	assert.True(t, lock.UnLock(7777))
+
+	lock.SetKeyEncoder(distlock.HashedKeyEncoder("h-"))
+	lock1.SetKeyEncoder(distlock.HashedKeyEncoder("h-"))
+	long := strings.Repeat("long", 100)
+	assert.True(t, lock.TryLock(7777))
+	assert.True(t, lock1.TryLock("7777"))
+	assert.True(t, lock.TryLock(long))
+	assert.False(t, lock1.TryLock(long))
+	assert.True(t, lock.UnLock(7777))
+	assert.True(t, lock1.UnLock("7777"))
+	assert.True(t, lock.UnLock(long))
+
+	lock.SetKeyEncoder(distlock.EscapedKeyEncoder)
+	lock1.SetKeyEncoder(distlock.EscapedKeyEncoder)
+	assert.True(t, lock.TryLock("a/b"))
+	assert.False(t, lock1.TryLock("a/b"))
+	assert.True(t, lock1.TryLock(".."))
+	assert.True(t, lock.UnLock("a/b"))
+	assert.True(t, lock1.UnLock(".."))
+
+	lock.SetKeyEncoder(distlock.KeyEncoderFunc(func(target interface{}) (string, error) {
+		return "", errors.New("unsupported target")
+	}))
+	err := lock.TryAcquire("a")
+	assert.True(t, errors.Is(err, distlock.ErrIllegalKey))
+	assert.EqualError(t, err, "Illegal key: unsupported target")
+	assert.False(t, lock.TryLock("a"))
+
+	if validator, ok := s.(distlock.KeyValidator); ok {
+		lock.SetKeyEncoder(nil)
+		if validator.ValidateKey(&distlock.LockKey{Namespace: "testns", Key: long}) != nil {
+			assert.True(t, errors.Is(lock.TryAcquire(long), distlock.ErrIllegalKey))
+		}
+		if validator.ValidateKey(&distlock.LockKey{Namespace: "testns", Key: "a/b"}) != nil {
+			assert.True(t, errors.Is(lock.Release("a/b"), distlock.ErrIllegalKey))
+			// other primitives build keys the same way
+			_, err := distlock.NewOnceGroup("testns", s).Once(context.Background(), "a/b", time.Second, func() (string, error) {
+				return "never", nil
+			})
+			assert.True(t, errors.Is(err, distlock.ErrIllegalKey))
+			if store, ok := s.(distlock.AtomicStore); ok {
+				barrier := distlock.NewBarrier("testns", "a/b", 2, store)
+				assert.True(t, errors.Is(barrier.Wait(context.Background()), distlock.ErrIllegalKey))
+				assert.Equal(t, 0, barrier.Waiting())
+			}
+		}
+	}
+}
+
+func DoTestList(t *testing.T, s distlock.Store) {
+	lister := s.(distlock.Lister)
+	a := &distlock.LockKey{Namespace: "testns-list", Key: "a"}
+	b := &distlock.LockKey{Namespace: "testns-list", Key: "b"}
+	other := &distlock.LockKey{Namespace: "testns", Key: "list"}
+	expire := 2 * time.Second
+	s.Delete(a)
+	s.Delete(b)
+	s.Delete(other)
+
+	entries, err := lister.List("testns-list")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	s.Set(a, "va", expire)
+	s.Set(b, "vb", expire)
+	s.Set(other, "vo", expire)
+	entries, err = lister.List("testns-list")
+	assert.NoError(t, err)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LockKey.Key < entries[j].LockKey.Key
+	})
+	assert.Equal(t, 2, len(entries))
+	if len(entries) == 2 {
+		assert.Equal(t, *a, entries[0].LockKey)
+		assert.Equal(t, "va", entries[0].Value)
+		assert.True(t, entries[0].TTL > 0)
+		assert.Equal(t, *b, entries[1].LockKey)
+		assert.Equal(t, "vb", entries[1].Value)
+	}
+
+	s.Delete(a)
+	entries, err = lister.List("testns-list")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	s.Delete(b)
+	s.Delete(other)
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package storetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+)
+
+// TLSFixture holds a throwaway CA with the certificates of server("localhost") and client("client")
+//	signed by it, for testing the stores against TLS-enabled stand-ins.
+type TLSFixture struct {
+	Dir      string
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	server   tls.Certificate
+	pool     *x509.CertPool
+}
+
+// NewTLSFixture generates the certificates into a temporary directory removed after the test
+func NewTLSFixture(t *testing.T) *TLSFixture {
+	dir, err := ioutil.TempDir("", "distlock-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	caKey, caCert := issue(t, "ca", nil, nil)
+	serverKey, serverCert := issue(t, "localhost", caKey, caCert)
+	clientKey, clientCert := issue(t, "client", caKey, caCert)
+	f := &TLSFixture{
+		Dir:      dir,
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client-key.pem"),
+		server: tls.Certificate{
+			Certificate: [][]byte{serverCert.Raw},
+			PrivateKey:  serverKey,
+		},
+		pool: x509.NewCertPool(),
+	}
+	f.pool.AddCert(caCert)
+	writePem(t, f.CAFile, "CERTIFICATE", caCert.Raw)
+	writePem(t, f.CertFile, "CERTIFICATE", clientCert.Raw)
+	der, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePem(t, f.KeyFile, "EC PRIVATE KEY", der)
+	return f
+}
+
+// issue creates a certificate signed by parent, or a self-signed CA if parent is nil
+func issue(t *testing.T, name string, parentKey *ecdsa.PrivateKey, parent *x509.Certificate) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.DNSNames = []string{name}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func writePem(t *testing.T, path, typ string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Config returns the options of store to connect the stand-ins with client certificate
+func (f *TLSFixture) Config() distlock.TLSConfig {
+	return distlock.TLSConfig{
+		CAFile:     f.CAFile,
+		CertFile:   f.CertFile,
+		KeyFile:    f.KeyFile,
+		ServerName: "localhost",
+	}
+}
+
+// Serve starts a stand-in requiring client certificates signed by the CA and closed after the test.
+//	Every connection verified is handled by serve in its own goroutine, and the common name of
+//	its client is sent to the returned channel.
+func (f *TLSFixture) Serve(t *testing.T, serve func(conn net.Conn)) (addr string, clients <-chan string) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{f.server},
+		ClientCAs:    f.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		NextProtos:   []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	ch := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				tlsConn := conn.(*tls.Conn)
+				if err := tlsConn.Handshake(); err != nil {
+					conn.Close()
+					return
+				}
+				select {
+				case ch <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName:
+				default:
+				}
+				if serve == nil {
+					conn.Close()
+					return
+				}
+				serve(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String(), ch
+}
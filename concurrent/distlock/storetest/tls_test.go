@@ -0,0 +1,70 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package storetest
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSConfig(t *testing.T) {
+	f := NewTLSFixture(t)
+	cfg := f.Config()
+	tlsConfig, err := cfg.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", tlsConfig.ServerName)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Equal(t, 1, len(tlsConfig.Certificates))
+
+	_, err = (&distlock.TLSConfig{CAFile: f.Dir + "/absent.pem"}).Build()
+	assert.Error(t, err)
+	_, err = (&distlock.TLSConfig{CAFile: f.KeyFile}).Build()
+	assert.Error(t, err)
+	_, err = (&distlock.TLSConfig{CertFile: f.CertFile}).Build()
+	assert.Error(t, err)
+	tlsConfig, err = (&distlock.TLSConfig{InsecureSkipVerify: true}).Build()
+	assert.NoError(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.RootCAs)
+}
+
+func TestTLSFixture(t *testing.T) {
+	f := NewTLSFixture(t)
+	addr, clients := f.Serve(t, nil)
+
+	cfg := f.Config()
+	tlsConfig, _ := cfg.Build()
+	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	assert.NoError(t, err)
+	if err == nil {
+		conn.Close()
+	}
+	select {
+	case name := <-clients:
+		assert.Equal(t, "client", name)
+	case <-time.After(time.Second):
+		t.Fatal("Client isn't verified")
+	}
+
+	// without client certificate
+	cfg.CertFile, cfg.KeyFile = "", ""
+	tlsConfig, _ = cfg.Build()
+	conn, err = tls.Dial("tcp", addr, tlsConfig)
+	if err == nil {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	assert.Error(t, err)
+	select {
+	case <-clients:
+		t.Fatal("Client without certificate is accepted")
+	default:
+	}
+}
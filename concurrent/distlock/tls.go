@@ -0,0 +1,56 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package distlock
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSConfig describes how the network stores talk to TLS-protected servers
+type TLSConfig struct {
+	// CAFile is the PEM bundle of CAs to verify servers, the system pool is used if empty
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and its key, for mutual TLS
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name to verify the certificate of server, the host dialed by default
+	ServerName string
+	// InsecureSkipVerify accepts any certificate of server, only for development
+	InsecureSkipVerify bool
+}
+
+// Build loads the certificates and returns the config for crypto/tls
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificate found in CA bundle %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("Both certificate and key of client should be specified")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
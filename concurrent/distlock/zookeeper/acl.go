@@ -0,0 +1,91 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"strings"
+
+	"github.com/jasonjoo2010/go-zookeeper/zk"
+)
+
+type auth struct {
+	scheme string
+	auth   []byte
+}
+
+// WithAuth adds the credential of scheme to the connection, eg. "digest" with "user:password".
+//	Only schemes authenticated by AddAuth are supported by the client. The handshake of SASL
+//	(Kerberos) isn't, but nodes can still be protected by ACLs of "sasl" scheme through {WithAcls}.
+func WithAuth(scheme string, auth []byte) Option {
+	return func(o *LockerOption) {
+		o.auths = append(o.auths, authOf(scheme, auth))
+	}
+}
+
+func authOf(scheme string, a []byte) auth {
+	return auth{scheme: scheme, auth: a}
+}
+
+// WithAcls appends ACLs applied to all directories and lock nodes.
+//	World is granted all permissions only if no ACL is specified.
+func WithAcls(acls ...zk.ACL) Option {
+	return func(o *LockerOption) {
+		o.acls = append(o.acls, acls...)
+	}
+}
+
+// WithIPAcl grants permissions to addresses in the form of ip or cidr, eg. "10.0.0.0/8"
+func WithIPAcl(perms int32, addrs ...string) Option {
+	acls := make([]zk.ACL, 0, len(addrs))
+	for _, addr := range addrs {
+		acls = append(acls, zk.ACL{Perms: perms, Scheme: "ip", ID: addr})
+	}
+	return WithAcls(acls...)
+}
+
+// WithNamespaceAcl overrides the ACLs of the directories and lock nodes of a namespace
+func WithNamespaceAcl(namespace string, acls ...zk.ACL) Option {
+	return func(o *LockerOption) {
+		if o.namespaceAcls == nil {
+			o.namespaceAcls = make(map[string][]zk.ACL)
+		}
+		o.namespaceAcls[namespace] = acls
+	}
+}
+
+// buildAcl returns the ACLs applied by default
+func buildAcl(opt *LockerOption) []zk.ACL {
+	var acl []zk.ACL
+	if opt.acl != nil && opt.acl.Username != "" {
+		acl = append(acl, zk.WorldACL(zk.PermRead)...)
+		acl = append(acl, zk.DigestACL(zk.PermAll, opt.acl.Username, opt.acl.Password)...)
+	}
+	acl = append(acl, opt.acls...)
+	if len(acl) == 0 {
+		return zk.WorldACL(zk.PermAll)
+	}
+	return acl
+}
+
+// buildAuths returns the credentials added to connection
+func buildAuths(opt *LockerOption) []auth {
+	var auths []auth
+	if opt.acl != nil && opt.acl.Username != "" {
+		auths = append(auths, authOf("digest", []byte(opt.acl.Username+":"+opt.acl.Password)))
+	}
+	return append(auths, opt.auths...)
+}
+
+// aclOf returns the ACLs of namespace
+func (z *ZookeeperLocker) aclOf(namespace string) []zk.ACL {
+	if acl, ok := z.namespaceAcls[namespace]; ok {
+		return acl
+	}
+	// sequential locks share the policy of namespace
+	if acl, ok := z.namespaceAcls[strings.TrimSuffix(namespace, NAMESPACE_SUFFIX)]; ok {
+		return acl
+	}
+	return z.acl
+}
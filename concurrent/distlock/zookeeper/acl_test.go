@@ -0,0 +1,90 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func options(opts ...Option) *LockerOption {
+	opt := &LockerOption{}
+	for _, fn := range opts {
+		fn(opt)
+	}
+	return opt
+}
+
+func TestBuildAcl(t *testing.T) {
+	assert.Equal(t, zk.WorldACL(zk.PermAll), buildAcl(options()))
+	assert.Empty(t, buildAuths(options()))
+
+	opt := options(WithAcl("user", "pass"))
+	acl := buildAcl(opt)
+	assert.Equal(t, 2, len(acl))
+	assert.Equal(t, zk.WorldACL(zk.PermRead)[0], acl[0])
+	assert.Equal(t, "digest", acl[1].Scheme)
+	assert.Equal(t, []auth{{"digest", []byte("user:pass")}}, buildAuths(opt))
+
+	opt = options(
+		WithIPAcl(zk.PermAll, "127.0.0.1", "10.0.0.0/8"),
+		WithAcls(zk.ACL{Perms: zk.PermRead, Scheme: "sasl", ID: "locker@EXAMPLE.COM"}),
+		WithAuth("sasl", []byte("locker")),
+	)
+	assert.Equal(t, []zk.ACL{
+		{Perms: zk.PermAll, Scheme: "ip", ID: "127.0.0.1"},
+		{Perms: zk.PermAll, Scheme: "ip", ID: "10.0.0.0/8"},
+		{Perms: zk.PermRead, Scheme: "sasl", ID: "locker@EXAMPLE.COM"},
+	}, buildAcl(opt))
+	assert.Equal(t, []auth{{"sasl", []byte("locker")}}, buildAuths(opt))
+}
+
+func TestAclOf(t *testing.T) {
+	ipAcl := []zk.ACL{{Perms: zk.PermAll, Scheme: "ip", ID: "127.0.0.1"}}
+	opt := options(WithAcl("user", "pass"), WithNamespaceAcl("private", ipAcl...))
+	z := &ZookeeperLocker{
+		acl:           buildAcl(opt),
+		namespaceAcls: opt.namespaceAcls,
+	}
+	assert.Equal(t, z.acl, z.aclOf("public"))
+	assert.Equal(t, ipAcl, z.aclOf("private"))
+	assert.Equal(t, ipAcl, z.aclOf("private"+NAMESPACE_SUFFIX))
+}
+
+func TestAclApplied(t *testing.T) {
+	ipAcl := []zk.ACL{{Perms: zk.PermAll, Scheme: "ip", ID: "127.0.0.1"}}
+	store, err := Open("test", 60000, []string{"127.0.0.1:2181"},
+		WithRoot("/demolock"),
+		WithAcl("user", "pass"),
+		WithNamespaceAcl("private", ipAcl...),
+		WithConnectTimeout(time.Second),
+	)
+	if err != nil {
+		t.Skipf("Zookeeper isn't available: %v", err)
+	}
+	lock := distlock.NewMutex("test", 60*time.Second, store)
+	private := distlock.NewMutex("private", 60*time.Second, store)
+	assert.True(t, lock.TryLock("a"))
+	assert.True(t, private.TryLock("a"))
+
+	acl, _, err := store.conn.GetACL(store.key(&distlock.LockKey{Namespace: "test", Key: "a"}))
+	assert.NoError(t, err)
+	assert.Equal(t, store.acl, acl)
+	acl, _, err = store.conn.GetACL(store.key(&distlock.LockKey{Namespace: "private", Key: "a"}))
+	assert.NoError(t, err)
+	assert.Equal(t, ipAcl, acl)
+	acl, _, err = store.conn.GetACL("/demolock/private/0")
+	assert.NoError(t, err)
+	assert.Equal(t, ipAcl, acl)
+
+	assert.True(t, lock.UnLock("a"))
+	assert.True(t, private.UnLock("a"))
+	removePath(store.conn, "/demolock")
+	store.Close()
+}
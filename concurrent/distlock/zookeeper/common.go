@@ -8,6 +8,7 @@ import (
 	"crypto/md5"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
 	"github.com/jasonjoo2010/go-zookeeper/zk"
@@ -23,9 +24,9 @@ func (z *ZookeeperLocker) exists(pathPlain string) bool {
 	return result
 }
 
-func (z *ZookeeperLocker) createPath(pathPlain string, createParent bool) error {
+func (z *ZookeeperLocker) createPath(pathPlain string, createParent bool, acl []zk.ACL) error {
 	if !createParent {
-		_, err := z.conn.Create(pathPlain, nil, 0, z.acl)
+		_, err := z.conn.Create(pathPlain, nil, 0, acl)
 		return err
 	}
 	b := strings.Builder{}
@@ -36,7 +37,7 @@ func (z *ZookeeperLocker) createPath(pathPlain string, createParent bool) error
 		if z.exists(path) {
 			continue
 		}
-		_, err := z.conn.Create(path, nil, 0, z.acl)
+		_, err := z.conn.Create(path, nil, 0, acl)
 		if err != nil {
 			logrus.Warn("Failed to create path ", path, ": ", err.Error())
 			return err
@@ -45,26 +46,71 @@ func (z *ZookeeperLocker) createPath(pathPlain string, createParent bool) error
 	return nil
 }
 
-func (z *ZookeeperLocker) initialize() {
-	if !z.exists(z.prefix) {
-		z.createPath(z.prefix, true)
+// initialize creates the directories of prefix and shards
+func (z *ZookeeperLocker) initialize(namespace, prefix string) error {
+	acl := z.aclOf(namespace)
+	if !z.exists(prefix) {
+		z.createPath(z.root, true, z.acl)
+		z.createPath(prefix, false, acl)
 	}
 	for i := 0; i < z.shards; i++ {
-		path := z.prefix + "/" + strconv.Itoa(i)
+		path := prefix + "/" + strconv.Itoa(i)
 		if z.exists(path) {
 			continue
 		}
-		err := z.createPath(path, false)
+		err := z.createPath(path, false, acl)
 		if err != nil && err.Error() != zk.ErrNodeExists.Error() {
 			logrus.Error("Initialize distlock failed: ", err.Error())
+			return err
 		}
 	}
+	return nil
+}
+
+// namespaces records the prefixes initialized
+type namespaces struct {
+	sync.Mutex
+	prefixes map[string]string
+}
+
+// prefix returns the path of namespace and initializes it at the first time.
+//	The path is returned even if it failed, so the operation on it fails and it's retried next time.
+func (z *ZookeeperLocker) prefix(namespace string) string {
+	prefix, err := z.initNamespace(namespace)
+	if err != nil {
+		logrus.Warn("Failed to initialize namespace ", namespace, ": ", err.Error())
+	}
+	return prefix
+}
+
+// namespaceEscaper escapes namespaces into single znodes reversibly, "%" first then "/"
+var namespaceEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// namespacePath returns the path of namespace without initializing it
+func (z *ZookeeperLocker) namespacePath(namespace string) string {
+	return z.root + "/" + namespaceEscaper.Replace(namespace)
+}
+
+// initNamespace initializes the namespace if it hasn't been, and returns the path of it
+func (z *ZookeeperLocker) initNamespace(namespace string) (string, error) {
+	z.namespaces.Lock()
+	defer z.namespaces.Unlock()
+	if prefix, ok := z.namespaces.prefixes[namespace]; ok {
+		return prefix, nil
+	}
+	prefix := z.namespacePath(namespace)
+	// retry next time if failed
+	err := z.initialize(namespace, prefix)
+	if err == nil {
+		z.namespaces.prefixes[namespace] = prefix
+	}
+	return prefix, err
 }
 
 func (z *ZookeeperLocker) key(lockKey *distlock.LockKey) string {
 	b := strings.Builder{}
 	hash := md5.Sum([]byte(lockKey.Key))
-	b.WriteString(z.prefix)
+	b.WriteString(z.prefix(lockKey.Namespace))
 	b.WriteString("/")
 	b.WriteString(strconv.Itoa(int(hash[0]) % z.shards))
 	b.WriteString("/")
@@ -72,11 +118,13 @@ func (z *ZookeeperLocker) key(lockKey *distlock.LockKey) string {
 	return b.String()
 }
 
+// ValidateKey rejects keys which can't be a single znode
+func (z *ZookeeperLocker) ValidateKey(lockKey *distlock.LockKey) error {
+	return distlock.ValidatePathKey(lockKey)
+}
+
 func (z *ZookeeperLocker) check(lockKey *distlock.LockKey) {
 	if z.stopped {
 		panic("Locker has been stopped")
 	}
-	if lockKey.Namespace != z.namespace {
-		panic("Specific namespace is not allowed: " + lockKey.Namespace)
-	}
 }
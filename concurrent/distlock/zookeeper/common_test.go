@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
 	"github.com/jasonjoo2010/go-zookeeper/zk"
@@ -71,7 +72,7 @@ func TestCheck(t *testing.T) {
 	store := NewWithRoot("/demolock", "test", 60000, []string{"127.0.0.1:2181"})
 
 	assert.NotPanics(t, func() { store.check(&distlock.LockKey{"test", "a"}) })
-	assert.Panics(t, func() { store.check(&distlock.LockKey{"test1", "a"}) })
+	assert.NotPanics(t, func() { store.check(&distlock.LockKey{"test1", "a"}) })
 
 	removePath(store.conn, "/demolock")
 
@@ -79,6 +80,39 @@ func TestCheck(t *testing.T) {
 	assert.Panics(t, func() { store.check(&distlock.LockKey{"test", "a"}) })
 }
 
+func TestNamespaces(t *testing.T) {
+	store := NewWithRoot("/demolock", "test", 60000, []string{"127.0.0.1:2181"})
+
+	assert.False(t, store.exists("/demolock/test1"))
+	assert.Equal(t, 0, strings.Index(store.key(&distlock.LockKey{"test1", "a"}), "/demolock/test1/"))
+	assert.True(t, store.exists("/demolock/test1/0"))
+	assert.True(t, store.exists("/demolock/test1/1"))
+	assert.Equal(t, 0, strings.Index(store.key(&distlock.LockKey{"a/b", "a"}), "/demolock/a%2Fb/"))
+	assert.Equal(t, 0, strings.Index(store.key(&distlock.LockKey{"a_b", "a"}), "/demolock/a_b/"))
+
+	lock := distlock.NewMutex("test", 60*time.Second, store)
+	lock1 := distlock.NewMutex("test1", 60*time.Second, store)
+	assert.True(t, lock.TryLock("a"))
+	assert.True(t, lock1.TryLock("a"))
+	assert.True(t, lock.UnLock("a"))
+	assert.True(t, lock1.UnLock("a"))
+
+	removePath(store.conn, "/demolock")
+	store.Close()
+}
+
+func TestNamespacePath(t *testing.T) {
+	store := &ZookeeperLocker{root: "/demolock"}
+	paths := make(map[string]string)
+	for _, namespace := range []string{"a/b", "a_b", "a%2Fb", "a%b", "a%252Fb", "test"} {
+		path := store.namespacePath(namespace)
+		assert.NotContains(t, path[len("/demolock/"):], "/", namespace)
+		assert.NotContains(t, paths, path, namespace)
+		paths[path] = namespace
+	}
+	assert.Equal(t, "/demolock/test", store.namespacePath("test"))
+}
+
 func TestKey(t *testing.T) {
 	store := NewWithRoot("/demolock", "test", 60000, []string{"127.0.0.1:2181"})
 
@@ -0,0 +1,122 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/go-zookeeper/zk"
+)
+
+const (
+	DEFAULT_SESSION_TIMEOUT = 60 * time.Second
+	DEFAULT_CONNECT_TIMEOUT = 10 * time.Second
+)
+
+// ErrConnectTimeout indicates no session is established during the connect timeout
+var ErrConnectTimeout = errors.New("Can't connect to zookeeper server: timeout")
+
+// WithSessionTimeout specifies the session timeout negotiated with server, DEFAULT_SESSION_TIMEOUT by default
+func WithSessionTimeout(timeout time.Duration) Option {
+	return func(o *LockerOption) {
+		if timeout > 0 {
+			o.sessionTimeout = timeout
+		}
+	}
+}
+
+// WithConnectTimeout specifies how long to wait for the session on creation, DEFAULT_CONNECT_TIMEOUT by default
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *LockerOption) {
+		if timeout > 0 {
+			o.connectTimeout = timeout
+		}
+	}
+}
+
+// WithLogger replaces the logger of connection, the standard logger of logrus by default
+func WithLogger(logger zk.Logger) Option {
+	return func(o *LockerOption) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithLogInfo decides whether the informational messages of connection are logged, true by default
+func WithLogInfo(logInfo bool) Option {
+	return func(o *LockerOption) {
+		o.logInfo = logInfo
+	}
+}
+
+// WithDialer replaces how to dial the servers, eg. through a proxy
+func WithDialer(dialer zk.Dialer) Option {
+	return func(o *LockerOption) {
+		if dialer != nil {
+			o.dialer = dialer
+		}
+	}
+}
+
+// WithHostProvider replaces how to resolve and pick the servers
+func WithHostProvider(hostProvider zk.HostProvider) Option {
+	return func(o *LockerOption) {
+		if hostProvider != nil {
+			o.hostProvider = hostProvider
+		}
+	}
+}
+
+// WithChroot places all paths including root under the specified path, like the chroot suffix
+//	of connection string in other clients, eg. "/apps/order".
+func WithChroot(chroot string) Option {
+	chroot = strings.TrimRight(chroot, "/")
+	if chroot != "" && !strings.HasPrefix(chroot, "/") {
+		chroot = "/" + chroot
+	}
+	return func(o *LockerOption) {
+		o.chroot = chroot
+	}
+}
+
+// WithTLS connects to the secure client port of servers, over the dialer specified if any
+func WithTLS(tls distlock.TLSConfig) Option {
+	return func(o *LockerOption) {
+		o.tls = &tls
+	}
+}
+
+// tlsDialer wraps dialer to handshake over the connections dialed
+func tlsDialer(dialer zk.Dialer, config *tls.Config) zk.Dialer {
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		deadline := time.Now().Add(timeout)
+		conn, err := dialer(network, address, timeout)
+		if err != nil {
+			return nil, err
+		}
+		cfg := config
+		if cfg.ServerName == "" {
+			host, _, err := net.SplitHostPort(address)
+			if err == nil {
+				cfg = config.Clone()
+				cfg.ServerName = host
+			}
+		}
+		tlsConn := tls.Client(conn, cfg)
+		tlsConn.SetDeadline(deadline)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		return tlsConn, nil
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithChroot(t *testing.T) {
+	assert.Equal(t, "/apps/order", options(WithChroot("apps/order/")).chroot)
+	assert.Equal(t, "/apps", options(WithChroot("/apps")).chroot)
+	assert.Equal(t, "", options(WithChroot("/")).chroot)
+}
+
+func TestOpenTimeout(t *testing.T) {
+	var dials int32
+	start := time.Now()
+	store, err := Open("test", 60000, []string{"127.0.0.1:2181"},
+		WithConnectTimeout(300*time.Millisecond),
+		WithLogInfo(false),
+		WithDialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return nil, errors.New("unreachable")
+		}),
+	)
+	assert.Nil(t, store)
+	assert.Equal(t, ErrConnectTimeout, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.True(t, atomic.LoadInt32(&dials) > 0)
+
+	_, err = Open("test", 60000, nil)
+	assert.Error(t, err)
+	assert.Nil(t, NewWithOptions("test", 60000, nil))
+}
+
+func TestOpenWithChroot(t *testing.T) {
+	store, err := Open("test", 60000, []string{"127.0.0.1:2181"},
+		WithChroot("/demochroot"),
+		WithRoot("/lock"),
+		WithSessionTimeout(10*time.Second),
+		WithConnectTimeout(time.Second),
+	)
+	if err != nil {
+		t.Skipf("Zookeeper isn't available: %v", err)
+	}
+	assert.True(t, store.exists("/demochroot/lock/test/0"))
+	removePath(store.conn, "/demochroot")
+	store.Close()
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/strutils"
+	"github.com/jasonjoo2010/go-zookeeper/zk"
+	"github.com/sirupsen/logrus"
+)
+
+// Structure: /lock/<namespace>-sequential/[sharding]/<key>/_c_<guid>-lock-<sequence>
+
+const (
+	// NAMESPACE_SUFFIX separates the directories of sequential locks from the ones of store
+	NAMESPACE_SUFFIX = "-sequential"
+	LOCK_NODE_PREFIX = "lock-"
+)
+
+// SequentialLock is a zookeeper native lock following the recipe of ephemeral sequential nodes:
+//	Every contender creates a node under the directory of target and the lowest sequence wins,
+//	and the others watch their predecessors only. So it's fair, has no herd effect and the lock
+//	lives as long as the session without expiration.
+type SequentialLock struct {
+	locker    *ZookeeperLocker
+	namespace string
+	uuid      string
+	encoder   distlock.KeyEncoder
+	// nodes of myself by directories
+	holdings *distlock.Holdings
+	mutex    sync.Mutex
+	handlers []func(lockKey *distlock.LockKey)
+	cancel   func()
+}
+
+// NewSequentialMutex returns a non-reentry lock sharing the connection, root and ACL of locker
+func NewSequentialMutex(namespace string, locker *ZookeeperLocker) distlock.DistLock {
+	return newSequential(namespace, locker, false)
+}
+
+// NewSequentialReentry returns a reentry lock sharing the connection, root and ACL of locker
+func NewSequentialReentry(namespace string, locker *ZookeeperLocker) distlock.DistLock {
+	return newSequential(namespace, locker, true)
+}
+
+func newSequential(namespace string, locker *ZookeeperLocker, reentry bool) *SequentialLock {
+	if namespace == "" {
+		namespace = "distributed-lock"
+	}
+	uuid := strutils.RandString(20)
+	l := &SequentialLock{
+		locker:    locker,
+		namespace: namespace,
+		uuid:      uuid,
+		holdings:  distlock.NewHoldings(uuid, reentry),
+	}
+	l.cancel = locker.OnLost(l.lost)
+	return l
+}
+
+// OnLost registers a handler called when a lock held is lost along with an expired session
+func (l *SequentialLock) OnLost(handler func(lockKey *distlock.LockKey)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.handlers = append(l.handlers, handler)
+}
+
+func (l *SequentialLock) lost(lockKey *distlock.LockKey) {
+	if _, ok := l.holdings.Remove(l.locker.key(lockKey)); !ok {
+		return
+	}
+	l.mutex.Lock()
+	handlers := l.handlers
+	l.mutex.Unlock()
+	for _, handler := range handlers {
+		handler(lockKey)
+	}
+}
+
+// OwnerID returns the identity of current owner written in lock nodes
+func (l *SequentialLock) OwnerID() string {
+	return l.uuid
+}
+
+// SetKeyEncoder changes how targets are encoded into keys, distlock.DefaultKeyEncoder by default.
+//	It should be the same for all owners of a namespace.
+func (l *SequentialLock) SetKeyEncoder(encoder distlock.KeyEncoder) {
+	l.encoder = encoder
+}
+
+func (l *SequentialLock) dir(target interface{}) (*distlock.LockKey, string, error) {
+	lockKey, err := distlock.NewLockKey(l.locker, l.encoder, l.namespace+NAMESPACE_SUFFIX, target)
+	if err != nil {
+		return nil, "", err
+	}
+	l.locker.check(lockKey)
+	return lockKey, l.locker.key(lockKey), nil
+}
+
+// sequence parses the sequence from name of node
+func sequence(node string) int {
+	pos := strings.LastIndexByte(node, '-')
+	seq, err := strconv.Atoi(node[pos+1:])
+	if err != nil {
+		return -1
+	}
+	return seq
+}
+
+// enqueue creates the node of myself under dir
+func (l *SequentialLock) enqueue(dir string) (string, error) {
+	conn := l.locker.conn
+	acl := l.locker.aclOf(l.namespace)
+	for {
+		node, err := conn.CreateProtectedEphemeralSequential(dir+"/"+LOCK_NODE_PREFIX, []byte(l.uuid), acl)
+		if err != zk.ErrNoNode {
+			return node, err
+		}
+		// directory of target doesn't exist, or was just removed by the last owner
+		err = l.locker.createPath(dir, false, acl)
+		if err != nil && err != zk.ErrNodeExists {
+			return "", err
+		}
+	}
+}
+
+// dequeue removes the node and the directory if it's empty
+func (l *SequentialLock) dequeue(dir, node string) error {
+	conn := l.locker.conn
+	l.locker.untrack(node)
+	err := conn.Delete(node, -1)
+	if err != nil && err != zk.ErrNoNode {
+		logrus.Warn("Failed to remove lock node ", node, ": ", err.Error())
+		return err
+	}
+	// fails if others are waiting
+	conn.Delete(dir, -1)
+	return nil
+}
+
+// predecessor returns the node right before myself, or empty if I'm the first one
+func (l *SequentialLock) predecessor(dir, node string) (string, error) {
+	children, _, err := l.locker.conn.Children(dir)
+	if err != nil {
+		return "", err
+	}
+	name := node[strings.LastIndexByte(node, '/')+1:]
+	mine := sequence(name)
+	found := false
+	predecessor := ""
+	predecessorSeq := -1
+	for _, child := range children {
+		if child == name {
+			found = true
+			continue
+		}
+		seq := sequence(child)
+		if seq < mine && seq > predecessorSeq {
+			predecessor = child
+			predecessorSeq = seq
+		}
+	}
+	if !found {
+		// removed due to session expiration
+		return "", zk.ErrNoNode
+	}
+	return predecessor, nil
+}
+
+func (l *SequentialLock) hold(lockKey *distlock.LockKey, dir, node string) {
+	l.locker.track(node, lockKey)
+	l.holdings.Hold(dir, node)
+}
+
+// acquire waits in the queue until deadline, or doesn't wait if deadline is zero
+func (l *SequentialLock) acquire(lockKey *distlock.LockKey, dir string, deadline time.Time) bool {
+	node, err := l.enqueue(dir)
+	if err != nil {
+		logrus.Warn("Failed to create lock node under ", dir, ": ", err.Error())
+		return false
+	}
+	for {
+		predecessor, err := l.predecessor(dir, node)
+		if err != nil {
+			logrus.Warn("Failed to list lock nodes under ", dir, ": ", err.Error())
+			l.dequeue(dir, node)
+			return false
+		}
+		if predecessor == "" {
+			l.hold(lockKey, dir, node)
+			return true
+		}
+		if deadline.IsZero() {
+			l.dequeue(dir, node)
+			return false
+		}
+		exists, _, eventC, err := l.locker.conn.ExistsW(dir + "/" + predecessor)
+		if err != nil {
+			logrus.Warn("Failed to watch lock node ", predecessor, ": ", err.Error())
+			l.dequeue(dir, node)
+			return false
+		}
+		if !exists {
+			continue
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			l.dequeue(dir, node)
+			return false
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-eventC:
+			timer.Stop()
+		case <-timer.C:
+			l.dequeue(dir, node)
+			return false
+		}
+	}
+}
+
+func (l *SequentialLock) TryLock(target interface{}) bool {
+	lockKey, dir, err := l.dir(target)
+	if err != nil {
+		logrus.Warn("Can't lock ", target, ": ", err.Error())
+		return false
+	}
+	if reentered, err := l.holdings.Enter(dir); reentered || err != nil {
+		return reentered
+	}
+	return l.acquire(lockKey, dir, time.Time{})
+}
+
+// Lock waits in the queue of target in {wait} time or returns a LockFailed error.
+//	It fails immediately with an ErrHeld if a mutex has held target already.
+func (l *SequentialLock) Lock(target interface{}, wait time.Duration) error {
+	lockKey, dir, err := l.dir(target)
+	if err != nil {
+		logrus.Warn("Can't lock ", target, ": ", err.Error())
+		return distlock.LockFailed
+	}
+	if reentered, err := l.holdings.Enter(dir); reentered || err != nil {
+		return err
+	}
+	if !l.acquire(lockKey, dir, time.Now().Add(wait)) {
+		return distlock.LockFailed
+	}
+	return nil
+}
+
+// Keep does nothing but checking the node still exists, because the lock lives as long as the session.
+func (l *SequentialLock) Keep(target interface{}) {
+	_, dir, err := l.dir(target)
+	if err != nil {
+		return
+	}
+	node, ok := l.holdings.Get(dir)
+	if !ok {
+		return
+	}
+	if exists, _, _ := l.locker.conn.Exists(node.(string)); !exists {
+		logrus.Warn("Lock of ", target, " has been lost")
+	}
+}
+
+func (l *SequentialLock) UnLock(target interface{}) bool {
+	_, dir, err := l.dir(target)
+	if err != nil {
+		return false
+	}
+	node, held, last := l.holdings.Leave(dir)
+	if !held {
+		return false
+	}
+	if !last {
+		return true
+	}
+	return l.dequeue(dir, node.(string)) == nil
+}
+
+// Close releases all locks held but leaves the connection of locker open,
+//	which should be closed by its creator.
+func (l *SequentialLock) Close() {
+	l.cancel()
+	for dir, node := range l.holdings.Clear() {
+		l.dequeue(dir, node.(string))
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequentialMutex(t *testing.T) {
+	store := NewWithRoot("/demo", "testns", 2000, []string{"127.0.0.1:2181"})
+	lock := NewSequentialMutex("testns", store)
+	lock1 := NewSequentialMutex("testns", store)
+	id := 3333
+
+	assert.True(t, lock.TryLock(id))
+	assert.False(t, lock.TryLock(id))
+	// fails fast rather than waits for myself
+	start := time.Now()
+	var held *distlock.ErrHeld
+	assert.True(t, errors.As(lock.Lock(id, time.Second), &held))
+	assert.Equal(t, lock.(*SequentialLock).OwnerID(), held.Owner)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.False(t, lock1.TryLock(id))
+	assert.Error(t, lock1.Lock(id, 200*time.Millisecond))
+	lock.Keep(id)
+	assert.True(t, lock.UnLock(id))
+	assert.False(t, lock.UnLock(id))
+
+	// no expiration
+	assert.NoError(t, lock1.Lock(id, time.Second))
+	time.Sleep(2500 * time.Millisecond)
+	assert.False(t, lock.TryLock(id))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		lock1.UnLock(id)
+	}()
+	assert.NoError(t, lock.Lock(id, time.Second))
+	lock.Close()
+	assert.True(t, lock1.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+
+	removePath(store.conn, "/demo")
+	store.Close()
+}
+
+func TestSequentialReentry(t *testing.T) {
+	store := NewWithRoot("/demo", "testns", 2000, []string{"127.0.0.1:2181"})
+	lock := NewSequentialReentry("testns", store)
+	lock1 := NewSequentialReentry("testns", store)
+	id := 3333
+
+	assert.True(t, lock.TryLock(id))
+	assert.NoError(t, lock.Lock(id, 0))
+	assert.False(t, lock1.TryLock(id))
+	assert.True(t, lock.UnLock(id))
+	assert.False(t, lock1.TryLock(id))
+	assert.True(t, lock.UnLock(id))
+	assert.True(t, lock1.TryLock(id))
+	assert.True(t, lock1.UnLock(id))
+
+	removePath(store.conn, "/demo")
+	store.Close()
+}
+
+func TestSequentialFairness(t *testing.T) {
+	store := NewWithRoot("/demo", "testns", 2000, []string{"127.0.0.1:2181"})
+	holder := NewSequentialMutex("testns", store)
+	id := 3333
+	assert.True(t, holder.TryLock(id))
+
+	var order []int
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lock := NewSequentialMutex("testns", store)
+			assert.NoError(t, lock.Lock(id, 5*time.Second))
+			mutex.Lock()
+			order = append(order, i)
+			mutex.Unlock()
+			assert.True(t, lock.UnLock(id))
+		}(i)
+		// queued in order
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.True(t, holder.UnLock(id))
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+
+	removePath(store.conn, "/demo")
+	store.Close()
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"sync"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/go-zookeeper/zk"
+	"github.com/sirupsen/logrus"
+)
+
+// The connection reconnects with a new session automatically after the old one expired,
+//	but all ephemeral nodes created in the old session are gone. So the nodes created are
+//	tracked and reported as lost once the new session is established.
+
+type session struct {
+	sync.Mutex
+	// nodes created in current session
+	nodes    map[string]*distlock.LockKey
+	handlers map[int]func(lockKey *distlock.LockKey)
+	seq      int
+}
+
+// track records an ephemeral node created in current session
+func (z *ZookeeperLocker) track(path string, lockKey *distlock.LockKey) {
+	z.session.Lock()
+	defer z.session.Unlock()
+	if z.session.nodes == nil {
+		z.session.nodes = make(map[string]*distlock.LockKey)
+	}
+	z.session.nodes[path] = lockKey
+}
+
+func (z *ZookeeperLocker) untrack(path string) {
+	z.session.Lock()
+	defer z.session.Unlock()
+	delete(z.session.nodes, path)
+}
+
+// OnLost registers a handler called with the key of every lock lost along with an expired session
+func (z *ZookeeperLocker) OnLost(handler func(lockKey *distlock.LockKey)) (cancel func()) {
+	z.session.Lock()
+	defer z.session.Unlock()
+	if z.session.handlers == nil {
+		z.session.handlers = make(map[int]func(lockKey *distlock.LockKey))
+	}
+	z.session.seq++
+	id := z.session.seq
+	z.session.handlers[id] = handler
+	return func() {
+		z.session.Lock()
+		defer z.session.Unlock()
+		delete(z.session.handlers, id)
+	}
+}
+
+// watch consumes the session events until the connection is closed
+func (z *ZookeeperLocker) watch(eventC <-chan zk.Event) {
+	expired := false
+	for event := range eventC {
+		if event.Type != zk.EventSession {
+			continue
+		}
+		switch event.State {
+		case zk.StateExpired:
+			logrus.Warn("Zookeeper session expired, reconnecting")
+			expired = true
+		case zk.StateHasSession:
+			if expired {
+				expired = false
+				z.recover()
+			}
+		}
+	}
+}
+
+// recover re-creates the structure and reports the locks lost in new session
+func (z *ZookeeperLocker) recover() {
+	logrus.Info("Zookeeper session re-established: ", z.conn.SessionID())
+	z.namespaces.Lock()
+	z.namespaces.prefixes = make(map[string]string)
+	z.namespaces.Unlock()
+	z.prefix(z.namespace)
+
+	z.session.Lock()
+	nodes := z.session.nodes
+	z.session.nodes = make(map[string]*distlock.LockKey)
+	handlers := make([]func(lockKey *distlock.LockKey), 0, len(z.session.handlers))
+	for _, handler := range z.session.handlers {
+		handlers = append(handlers, handler)
+	}
+	z.session.Unlock()
+	for path, lockKey := range nodes {
+		logrus.Warn("Lock lost along with the expired session: ", path)
+		for _, handler := range handlers {
+			handler(lockKey)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionLost(t *testing.T) {
+	store := NewWithRoot("/demo", "testns", 2000, []string{"127.0.0.1:2181"})
+	lock := distlock.NewMutex("testns", 2*time.Second, store).(*distlock.DistLockImpl)
+	sequential := NewSequentialMutex("testns", store).(*SequentialLock)
+	var lost []string
+	mutex := sync.Mutex{}
+	handler := func(lockKey *distlock.LockKey) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		lost = append(lost, lockKey.Key)
+	}
+	assert.True(t, lock.OnLost(handler))
+	sequential.OnLost(handler)
+
+	assert.True(t, lock.TryLock("a"))
+	assert.True(t, lock.TryLock("c"))
+	assert.True(t, lock.UnLock("c"))
+	assert.True(t, sequential.TryLock("b"))
+
+	// as if the session was re-established
+	store.recover()
+	assert.ElementsMatch(t, []string{"a", "b"}, lost)
+	assert.False(t, sequential.UnLock("b"))
+	assert.True(t, store.exists("/demo/testns/0"))
+
+	removePath(store.conn, "/demo")
+	store.Close()
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package zookeeper
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSDialer(t *testing.T) {
+	f := storetest.NewTLSFixture(t)
+	addr, clients := f.Serve(t, nil)
+
+	cfg := f.Config()
+	tlsConfig, err := cfg.Build()
+	assert.NoError(t, err)
+	conn, err := tlsDialer(net.DialTimeout, tlsConfig)("tcp", addr, time.Second)
+	assert.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, "client", <-clients)
+
+	// server name is taken from address, the certificate is issued for 127.0.0.1 as well
+	cfg.ServerName = ""
+	tlsConfig, _ = cfg.Build()
+	conn, err = tlsDialer(net.DialTimeout, tlsConfig)("tcp", addr, time.Second)
+	assert.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, "client", <-clients)
+
+	// server isn't trusted
+	cfg.CAFile = ""
+	tlsConfig, _ = cfg.Build()
+	_, err = tlsDialer(net.DialTimeout, tlsConfig)("tcp", addr, time.Second)
+	assert.Error(t, err)
+}
+
+func TestOpenTLS(t *testing.T) {
+	f := storetest.NewTLSFixture(t)
+	// the stand-in only verifies the client and doesn't speak zookeeper
+	addr, clients := f.Serve(t, nil)
+
+	_, err := Open("test", 60000, []string{addr},
+		WithTLS(f.Config()),
+		WithConnectTimeout(500*time.Millisecond),
+		WithLogInfo(false),
+	)
+	assert.Equal(t, ErrConnectTimeout, err)
+	assert.Equal(t, "client", <-clients)
+
+	_, err = Open("test", 60000, []string{addr}, WithTLS(distlock.TLSConfig{CAFile: f.Dir + "/absent.pem"}))
+	assert.Error(t, err)
+}
@@ -5,6 +5,11 @@
 package zookeeper
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,7 +18,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// Structure: /lock/<namespace>/[sharding]/<md5(key)>
+// Structure: /lock/<namespace>/[sharding]/<key>
 
 type ACL struct {
 	Username, Password string
@@ -25,16 +30,31 @@ type ZookeeperLocker struct {
 	conn      *zk.Conn
 	namespace string
 	ttl       int64
-	prefix    string
+	root      string
 	shards    int
 	acl       []zk.ACL
-	stopped   bool
+	// namespaceAcls overrides acl for the namespaces
+	namespaceAcls map[string][]zk.ACL
+	namespaces    namespaces
+	session       session
+	stopped       bool
 }
 
 type LockerOption struct {
-	root         string
-	acl          *ACL
-	shardingBits int
+	root           string
+	chroot         string
+	acl            *ACL
+	shardingBits   int
+	auths          []auth
+	acls           []zk.ACL
+	namespaceAcls  map[string][]zk.ACL
+	sessionTimeout time.Duration
+	connectTimeout time.Duration
+	logger         zk.Logger
+	logInfo        bool
+	dialer         zk.Dialer
+	hostProvider   zk.HostProvider
+	tls            *distlock.TLSConfig
 }
 
 func WithShardingBits(bits int) Option {
@@ -65,31 +85,57 @@ func WithAcl(username, password string) Option {
 }
 
 // New create a zookeeper locker based on specific namespace
-//	Due to extra initialization should be done before using so you cannot
-//	invoke it with different namespaces after creation.
+//	The namespace is initialized on creation, and directories of other namespaces
+//	are created lazily when they're used at the first time.
 func New(namespace string, ttl int64, addrs []string) *ZookeeperLocker {
 	return NewWithRoot("/lock", namespace, ttl, addrs)
 }
 
+// NewWithOptions works like {Open} but logs the error and returns nil when failed
 func NewWithOptions(namespace string, ttl int64, addrs []string, opts ...Option) *ZookeeperLocker {
+	instance, err := Open(namespace, ttl, addrs, opts...)
+	if err != nil {
+		logrus.Error("Can't initialize zookeeper locker: ", err.Error())
+		return nil
+	}
+	return instance
+}
+
+// Open connects to zookeeper, waits for the session and initializes the namespace
+func Open(namespace string, ttl int64, addrs []string, opts ...Option) (*ZookeeperLocker, error) {
 	opt := &LockerOption{
-		root:         "/lock",
-		shardingBits: 1,
+		root:           "/lock",
+		shardingBits:   1,
+		sessionTimeout: DEFAULT_SESSION_TIMEOUT,
+		connectTimeout: DEFAULT_CONNECT_TIMEOUT,
+		logger:         logrus.StandardLogger(),
+		logInfo:        true,
+		dialer:         net.DialTimeout,
+		hostProvider:   &zk.DNSHostProvider{},
 	}
 	for _, fn := range opts {
 		fn(opt)
 	}
+	if opt.tls != nil {
+		tlsConfig, err := opt.tls.Build()
+		if err != nil {
+			return nil, err
+		}
+		opt.dialer = tlsDialer(opt.dialer, tlsConfig)
+	}
 	conn, eventC, err := zk.Connect(
 		addrs,
-		60*time.Second,
-		zk.WithLogger(logrus.StandardLogger()),
-		zk.WithLogInfo(true),
+		opt.sessionTimeout,
+		zk.WithLogger(opt.logger),
+		zk.WithLogInfo(opt.logInfo),
+		zk.WithDialer(opt.dialer),
+		zk.WithHostProvider(opt.hostProvider),
 	)
 	if err != nil {
-		logrus.Error("Can't initialize zookeeper locker: ", err.Error())
-		return nil
+		return nil, err
 	}
-	timeout := time.NewTimer(10 * time.Second)
+	timeout := time.NewTimer(opt.connectTimeout)
+	defer timeout.Stop()
 LOOP_CHECK:
 	for {
 		select {
@@ -98,27 +144,35 @@ LOOP_CHECK:
 				break LOOP_CHECK
 			}
 		case <-timeout.C:
-			logrus.Error("Can't connect to zookeeper server: timeout")
-			return nil
+			conn.Close()
+			return nil, ErrConnectTimeout
 		}
 	}
 	// initial structure
 	instance := &ZookeeperLocker{
-		conn:      conn,
-		namespace: namespace,
-		ttl:       ttl,
-		shards:    1 << opt.shardingBits,
-		prefix:    opt.root + "/" + strings.ReplaceAll(namespace, "/", "_"),
-		acl:       zk.WorldACL(zk.PermAll),
-	}
-	if opt.acl != nil && opt.acl.Username != "" {
-		instance.acl = []zk.ACL{}
-		instance.acl = append(instance.acl, zk.WorldACL(zk.PermRead)...)
-		instance.acl = append(instance.acl, zk.DigestACL(zk.PermAll, opt.acl.Username, opt.acl.Password)...)
-		conn.AddAuth("digest", []byte(opt.acl.Username+":"+opt.acl.Password))
-	}
-	instance.initialize()
-	return instance
+		conn:          conn,
+		namespace:     namespace,
+		ttl:           ttl,
+		shards:        1 << opt.shardingBits,
+		root:          opt.chroot + opt.root,
+		acl:           buildAcl(opt),
+		namespaceAcls: opt.namespaceAcls,
+		namespaces: namespaces{
+			prefixes: make(map[string]string),
+		},
+	}
+	for _, a := range buildAuths(opt) {
+		if err := conn.AddAuth(a.scheme, a.auth); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Failed to add auth of %s: %w", a.scheme, err)
+		}
+	}
+	if _, err := instance.initNamespace(namespace); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go instance.watch(eventC)
+	return instance, nil
 }
 
 func NewWithRoot(root, namespace string, ttl int64, addrs []string) *ZookeeperLocker {
@@ -149,6 +203,7 @@ func (z *ZookeeperLocker) Exists(lockKey *distlock.LockKey) bool {
 	now := time.Now().UnixNano() / 1e6
 	if now-stat.Mtime > z.ttl {
 		z.conn.Delete(key, -1)
+		z.untrack(key)
 		return false
 	}
 	return true
@@ -176,21 +231,131 @@ func (z *ZookeeperLocker) SetIfAbsent(lockKey *distlock.LockKey, val string, exp
 	if z.Exists(lockKey) {
 		return false
 	}
-	_, err := z.conn.Create(key, []byte(val), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	_, err := z.conn.Create(key, []byte(val), zk.FlagEphemeral, z.aclOf(lockKey.Namespace))
 	if err != nil {
 		return false
 	}
+	z.track(key, lockKey)
 	return true
 }
 
+func (z *ZookeeperLocker) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	z.check(lockKey)
+	if old == "" {
+		return z.SetIfAbsent(lockKey, val, expire)
+	}
+	if !z.Exists(lockKey) {
+		return false
+	}
+	key := z.key(lockKey)
+	data, stat, err := z.conn.Get(key)
+	if err != nil || string(data) != old {
+		return false
+	}
+	// the version guarantees no one else has changed it since read
+	if stat.EphemeralOwner == z.conn.SessionID() {
+		_, err = z.conn.Set(key, []byte(val), stat.Version)
+		return err == nil
+	}
+	// take over the ephemeral node from another session, eg. a lock transferred to us
+	_, err = z.conn.Multi(
+		&zk.DeleteRequest{Path: key, Version: stat.Version},
+		&zk.CreateRequest{Path: key, Data: []byte(val), Acl: z.aclOf(lockKey.Namespace), Flags: zk.FlagEphemeral},
+	)
+	if err != nil {
+		return false
+	}
+	z.track(key, lockKey)
+	return true
+}
+
+// Watch arms a watch of the node again after every event, so its creation, deletion and
+//	changes of data are all notified.
+func (z *ZookeeperLocker) Watch(ctx context.Context, lockKey *distlock.LockKey) <-chan struct{} {
+	z.check(lockKey)
+	key := z.key(lockKey)
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		for !z.stopped {
+			_, _, eventC, err := z.conn.ExistsW(key)
+			if err != nil {
+				logrus.Warn("Watch failed: ", err.Error())
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-eventC:
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch
+}
+
 func (z *ZookeeperLocker) Delete(lockKey *distlock.LockKey) {
 	z.check(lockKey)
-	err := z.conn.Delete(z.key(lockKey), -1)
+	key := z.key(lockKey)
+	z.untrack(key)
+	err := z.conn.Delete(key, -1)
 	if err != nil {
 		logrus.Warn("Delete from zookeeper failed: ", err.Error())
 	}
 }
 
+// List walks the shards of namespace, whose directories aren't created if absent
+func (z *ZookeeperLocker) List(namespace string) ([]distlock.Entry, error) {
+	z.check(nil)
+	prefix := z.namespacePath(namespace)
+	now := time.Now().UnixNano() / 1e6
+	var entries []distlock.Entry
+	for i := 0; i < z.shards; i++ {
+		dir := prefix + "/" + strconv.Itoa(i)
+		children, _, err := z.conn.Children(dir)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			data, stat, err := z.conn.Get(dir + "/" + child)
+			if err == zk.ErrNoNode {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			ttl := z.ttl - (now - stat.Mtime)
+			if ttl <= 0 || len(data) == 0 {
+				continue
+			}
+			entries = append(entries, distlock.Entry{
+				LockKey: distlock.LockKey{Namespace: namespace, Key: child},
+				Value:   string(data),
+				TTL:     time.Duration(ttl) * time.Millisecond,
+			})
+		}
+	}
+	return entries, nil
+}
+
+func (z *ZookeeperLocker) Ping() error {
+	if state := z.conn.State(); state != zk.StateHasSession {
+		return errors.New("Zookeeper session is not ready: " + state.String())
+	}
+	return nil
+}
+
 func (z *ZookeeperLocker) Close() {
 	z.stopped = true
 	z.conn.Close()
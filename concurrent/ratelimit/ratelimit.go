@@ -0,0 +1,134 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+)
+
+// state format of limiters: fields separated by '|'
+
+const (
+	// MAX_RETRIES limits the compare-and-swap attempts of one operation under contention
+	MAX_RETRIES = 10
+	// MAX_WAIT_INTERVAL limits a single sleep in Wait
+	MAX_WAIT_INTERVAL = 100 * time.Millisecond
+)
+
+var Contended = errors.New("Too much contention on the limiter state")
+
+type Limiter interface {
+	// Allow consumes one permit of the key and returns true when it's allowed.
+	//	Failures, like an illegal key or too much contention, are denials as well, see {Take}.
+	Allow(key interface{}) bool
+	// Take works like {Allow} but returns the failure, distlock.ErrIllegalKey or Contended,
+	//	which also happens when the store is unreachable because every swap fails
+	Take(key interface{}) (bool, error)
+	// Wait blocks until one permit of the key is consumed or the context is done,
+	//	or returns distlock.ErrIllegalKey if the store doesn't accept the key
+	Wait(ctx context.Context, key interface{}) error
+	// Remaining returns the permits left currently without consuming any, 0 for an illegal key
+	Remaining(key interface{}) int
+	// Close leaves the store open, which is usually shared and should be closed by its creator
+	Close()
+}
+
+// algorithm describes how the shared state evolves
+type algorithm interface {
+	// take computes the state after consuming one permit
+	//	allowed is false and retryAfter is positive when no permit left
+	take(state string, now time.Time) (next string, allowed bool, retryAfter time.Duration)
+	// remaining returns the permits left in the state
+	remaining(state string, now time.Time) int
+	// expire returns the lifetime of an untouched state
+	expire() time.Duration
+}
+
+type limiter struct {
+	store     distlock.AtomicStore
+	namespace string
+	algo      algorithm
+}
+
+func newLimiter(namespace string, algo algorithm, store distlock.AtomicStore) *limiter {
+	if namespace == "" {
+		namespace = "rate-limit"
+	}
+	return &limiter{
+		store:     store,
+		namespace: namespace,
+		algo:      algo,
+	}
+}
+
+func (l *limiter) key(target interface{}) (*distlock.LockKey, error) {
+	return distlock.NewLockKey(l.store, nil, l.namespace, target)
+}
+
+// take tries to consume one permit with optimistic concurrency
+func (l *limiter) take(target interface{}) (allowed bool, retryAfter time.Duration, err error) {
+	lockKey, err := l.key(target)
+	if err != nil {
+		return false, 0, err
+	}
+	for i := 0; i < MAX_RETRIES; i++ {
+		old := l.store.Get(lockKey)
+		next, allowed, retryAfter := l.algo.take(old, time.Now())
+		if !allowed {
+			return false, retryAfter, nil
+		}
+		if l.store.CompareAndSwap(lockKey, old, next, l.algo.expire()) {
+			return true, 0, nil
+		}
+	}
+	return false, 0, Contended
+}
+
+func (l *limiter) Allow(target interface{}) bool {
+	allowed, _ := l.Take(target)
+	return allowed
+}
+
+func (l *limiter) Take(target interface{}) (bool, error) {
+	allowed, _, err := l.take(target)
+	return allowed, err
+}
+
+func (l *limiter) Wait(ctx context.Context, target interface{}) error {
+	for {
+		allowed, retryAfter, err := l.take(target)
+		if allowed {
+			return nil
+		}
+		if errors.Is(err, distlock.ErrIllegalKey) {
+			return err
+		}
+		if retryAfter <= 0 || retryAfter > MAX_WAIT_INTERVAL {
+			retryAfter = MAX_WAIT_INTERVAL
+		}
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *limiter) Remaining(target interface{}) int {
+	lockKey, err := l.key(target)
+	if err != nil {
+		return 0
+	}
+	return l.algo.remaining(l.store.Get(lockKey), time.Now())
+}
+
+func (l *limiter) Close() {
+}
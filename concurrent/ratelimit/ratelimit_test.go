@@ -0,0 +1,88 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWait(t *testing.T) {
+	limiter := NewTokenBucket("test", 1, 200*time.Millisecond, mock.New())
+	defer limiter.Close()
+
+	assert.NoError(t, limiter.Wait(context.Background(), "a"))
+	start := time.Now()
+	assert.NoError(t, limiter.Wait(context.Background(), "a"))
+	assert.True(t, time.Since(start) >= 150*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.Wait(ctx, "a"))
+}
+
+func TestShared(t *testing.T) {
+	store := mock.New()
+	l1 := NewSlidingWindow("test", 3, time.Second, store)
+	l2 := NewSlidingWindow("test", 3, time.Second, store)
+
+	assert.True(t, l1.Allow("a"))
+	assert.True(t, l2.Allow("a"))
+	assert.True(t, l1.Allow("a"))
+	assert.False(t, l2.Allow("a"))
+	assert.Equal(t, 0, l1.Remaining("a"))
+	assert.Equal(t, 3, l2.Remaining("b"))
+
+	// the shared store is still open
+	l1.Close()
+	assert.True(t, l2.Allow("b"))
+	assert.Equal(t, 2, l2.Remaining("b"))
+}
+
+// pathStore accepts only keys which are legal path segments
+type pathStore struct {
+	distlock.AtomicStore
+}
+
+func (s pathStore) ValidateKey(lockKey *distlock.LockKey) error {
+	return distlock.ValidatePathKey(lockKey)
+}
+
+func TestIllegalKey(t *testing.T) {
+	limiter := NewTokenBucket("test", 1, time.Second, pathStore{mock.New()})
+	defer limiter.Close()
+
+	assert.False(t, limiter.Allow("a/b"))
+	_, err := limiter.Take("a/b")
+	assert.True(t, errors.Is(err, distlock.ErrIllegalKey))
+	assert.True(t, errors.Is(limiter.Wait(context.Background(), "a/b"), distlock.ErrIllegalKey))
+	assert.Equal(t, 0, limiter.Remaining("a/b"))
+	assert.True(t, limiter.Allow("a"))
+}
+
+// swapless fails every swap like an unreachable store
+type swapless struct {
+	distlock.AtomicStore
+}
+
+func (s swapless) CompareAndSwap(lockKey *distlock.LockKey, old, val string, expire time.Duration) bool {
+	return false
+}
+
+func TestContended(t *testing.T) {
+	limiter := NewSlidingWindow("test", 1, time.Second, swapless{mock.New()})
+	defer limiter.Close()
+
+	allowed, err := limiter.Take("a")
+	assert.False(t, allowed)
+	assert.Equal(t, Contended, err)
+	assert.False(t, limiter.Allow("a"))
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+)
+
+// sliding window state: {current window start in millisecond}|{previous window count}|{current window count}
+
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+}
+
+// NewSlidingWindow returns a limiter allowing at most {limit} permits in any {window}
+//	The count of previous window is weighted by its overlap with the sliding one.
+//	namespace is used to separate different projects
+//	store decides which storage it uses
+func NewSlidingWindow(namespace string, limit int, window time.Duration, store distlock.AtomicStore) Limiter {
+	if window < time.Millisecond {
+		window = time.Millisecond
+	}
+	return newLimiter(namespace, &slidingWindow{
+		limit:  limit,
+		window: window,
+	}, store)
+}
+
+func parseWindow(state string) (start int64, prev, cur int, ok bool) {
+	arr := strings.Split(state, "|")
+	if len(arr) != 3 {
+		return
+	}
+	var err error
+	if start, err = strconv.ParseInt(arr[0], 10, 64); err != nil {
+		return
+	}
+	if prev, err = strconv.Atoi(arr[1]); err != nil {
+		return
+	}
+	if cur, err = strconv.Atoi(arr[2]); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+// slide moves the windows forward to now
+func (w *slidingWindow) slide(state string, now time.Time) (start int64, prev, cur int) {
+	size := int64(w.window / time.Millisecond)
+	nowMillis := now.UnixNano() / 1e6
+	aligned := nowMillis - nowMillis%size
+	start, prev, cur, ok := parseWindow(state)
+	switch {
+	case !ok || aligned-start >= 2*size:
+		return aligned, 0, 0
+	case aligned-start >= size:
+		return aligned, cur, 0
+	}
+	return start, prev, cur
+}
+
+// estimate returns the weighted count in the sliding window ending at now
+func (w *slidingWindow) estimate(start int64, prev, cur int, now time.Time) float64 {
+	size := float64(w.window / time.Millisecond)
+	elapsed := float64(now.UnixNano()/1e6 - start)
+	return float64(prev)*(size-elapsed)/size + float64(cur)
+}
+
+func (w *slidingWindow) take(state string, now time.Time) (string, bool, time.Duration) {
+	start, prev, cur := w.slide(state, now)
+	if w.estimate(start, prev, cur, now)+1 > float64(w.limit) {
+		// the weight of previous window decreases over time, so retry a little later
+		retry := w.window / 10
+		if prev == 0 {
+			retry = time.Duration(start*1e6+int64(w.window)) - time.Duration(now.UnixNano())
+		}
+		return state, false, retry
+	}
+	return fmt.Sprintf("%d|%d|%d", start, prev, cur+1), true, 0
+}
+
+func (w *slidingWindow) remaining(state string, now time.Time) int {
+	start, prev, cur := w.slide(state, now)
+	left := w.limit - int(math.Ceil(w.estimate(start, prev, cur, now)))
+	if left < 0 {
+		left = 0
+	}
+	return left
+}
+
+func (w *slidingWindow) expire() time.Duration {
+	return 2 * w.window
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWindow(t *testing.T) {
+	_, _, _, ok := parseWindow("")
+	assert.False(t, ok)
+	_, _, _, ok = parseWindow("1|2")
+	assert.False(t, ok)
+	_, _, _, ok = parseWindow("1|a|3")
+	assert.False(t, ok)
+
+	start, prev, cur, ok := parseWindow("1|2|3")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), start)
+	assert.Equal(t, 2, prev)
+	assert.Equal(t, 3, cur)
+}
+
+func TestWindowTake(t *testing.T) {
+	w := &slidingWindow{limit: 2, window: time.Second}
+	now := time.Unix(100, 0)
+
+	state, allowed, _ := w.take("", now)
+	assert.True(t, allowed)
+	assert.Equal(t, "100000|0|1", state)
+	state, allowed, _ = w.take(state, now.Add(100*time.Millisecond))
+	assert.True(t, allowed)
+	state, allowed, retry := w.take(state, now.Add(200*time.Millisecond))
+	assert.False(t, allowed)
+	assert.Equal(t, 800*time.Millisecond, retry)
+
+	// previous window weighs half
+	assert.Equal(t, 1, w.remaining(state, now.Add(1500*time.Millisecond)))
+	state, allowed, _ = w.take(state, now.Add(1500*time.Millisecond))
+	assert.True(t, allowed)
+	assert.Equal(t, "101000|2|1", state)
+	_, allowed, _ = w.take(state, now.Add(1500*time.Millisecond))
+	assert.False(t, allowed)
+
+	// all expired
+	assert.Equal(t, 2, w.remaining(state, now.Add(3*time.Second)))
+}
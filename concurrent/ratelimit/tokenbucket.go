@@ -0,0 +1,85 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+)
+
+// token bucket state: {tokens left}|{last refilled timestamp in millisecond}
+
+type tokenBucket struct {
+	capacity int
+	interval time.Duration
+}
+
+// NewTokenBucket returns a limiter refilling {capacity} tokens evenly in every {interval}
+//	namespace is used to separate different projects
+//	capacity is also the max burst allowed
+//	store decides which storage it uses
+func NewTokenBucket(namespace string, capacity int, interval time.Duration, store distlock.AtomicStore) Limiter {
+	return newLimiter(namespace, &tokenBucket{
+		capacity: capacity,
+		interval: interval,
+	}, store)
+}
+
+func parseBucket(state string) (tokens float64, refilled int64, ok bool) {
+	pos := strings.IndexByte(state, '|')
+	if pos < 0 {
+		return
+	}
+	tokens, err := strconv.ParseFloat(state[:pos], 64)
+	if err != nil {
+		return
+	}
+	refilled, err = strconv.ParseInt(state[pos+1:], 10, 64)
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+// refill returns the tokens available at now
+func (b *tokenBucket) refill(state string, now time.Time) float64 {
+	tokens, refilled, ok := parseBucket(state)
+	if !ok {
+		return float64(b.capacity)
+	}
+	elapsed := now.UnixNano()/1e6 - refilled
+	if elapsed > 0 && b.interval > 0 {
+		// in nanoseconds, so intervals shorter than a millisecond work too
+		tokens += float64(time.Duration(elapsed)*time.Millisecond) * float64(b.capacity) / float64(b.interval)
+	}
+	return math.Min(tokens, float64(b.capacity))
+}
+
+func (b *tokenBucket) take(state string, now time.Time) (string, bool, time.Duration) {
+	tokens := b.refill(state, now)
+	if tokens < 1 {
+		if b.capacity < 1 {
+			return state, false, 0
+		}
+		lack := (1 - tokens) * float64(b.interval) / float64(b.capacity)
+		return state, false, time.Duration(math.Ceil(lack))
+	}
+	return fmt.Sprintf("%s|%d", strconv.FormatFloat(tokens-1, 'f', -1, 64), now.UnixNano()/1e6), true, 0
+}
+
+func (b *tokenBucket) remaining(state string, now time.Time) int {
+	return int(b.refill(state, now))
+}
+
+func (b *tokenBucket) expire() time.Duration {
+	// a bucket untouched longer than this is full again
+	return b.interval + time.Second
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBucket(t *testing.T) {
+	_, _, ok := parseBucket("")
+	assert.False(t, ok)
+	_, _, ok = parseBucket("1.5")
+	assert.False(t, ok)
+	_, _, ok = parseBucket("a|100")
+	assert.False(t, ok)
+
+	tokens, refilled, ok := parseBucket("1.5|100")
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, tokens)
+	assert.Equal(t, int64(100), refilled)
+}
+
+func TestBucketTake(t *testing.T) {
+	b := &tokenBucket{capacity: 2, interval: 2 * time.Second}
+	now := time.Unix(100, 0)
+
+	state, allowed, _ := b.take("", now)
+	assert.True(t, allowed)
+	assert.Equal(t, "1|100000", state)
+	state, allowed, _ = b.take(state, now)
+	assert.True(t, allowed)
+	state, allowed, retry := b.take(state, now)
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, retry)
+	assert.Equal(t, 0, b.remaining(state, now))
+
+	// one token per second
+	assert.Equal(t, 1, b.remaining(state, now.Add(1500*time.Millisecond)))
+	assert.Equal(t, 2, b.remaining(state, now.Add(time.Minute)))
+	_, allowed, _ = b.take(state, now.Add(time.Second))
+	assert.True(t, allowed)
+}
+
+func TestBucketShortInterval(t *testing.T) {
+	// not truncated to a millisecond
+	b := &tokenBucket{capacity: 3, interval: 1500 * time.Microsecond}
+	now := time.Unix(100, 0)
+	state := ""
+	for i := 0; i < 3; i++ {
+		next, allowed, _ := b.take(state, now)
+		assert.True(t, allowed)
+		state = next
+	}
+	assert.Equal(t, 0, b.remaining(state, now))
+	assert.Equal(t, 2, b.remaining(state, now.Add(time.Millisecond)))
+	assert.Equal(t, 3, b.remaining(state, now.Add(2*time.Millisecond)))
+}
+
+func TestTokenBucket(t *testing.T) {
+	limiter := NewTokenBucket("test", 3, time.Second, mock.New())
+	defer limiter.Close()
+
+	assert.Equal(t, 3, limiter.Remaining("a"))
+	assert.True(t, limiter.Allow("a"))
+	assert.True(t, limiter.Allow("a"))
+	assert.True(t, limiter.Allow("a"))
+	assert.False(t, limiter.Allow("a"))
+	assert.True(t, limiter.Allow("b"))
+	assert.Equal(t, 0, limiter.Remaining("a"))
+	assert.Equal(t, 2, limiter.Remaining("b"))
+
+	time.Sleep(400 * time.Millisecond)
+	assert.Equal(t, 1, limiter.Remaining("a"))
+	assert.True(t, limiter.Allow("a"))
+	assert.False(t, limiter.Allow("a"))
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schedule interface {
+	// Next returns the first tick strictly after t
+	Next(t time.Time) time.Time
+}
+
+type interval time.Duration
+
+// Every returns a schedule ticking every {d}.
+//	Ticks are multiples of {d} in absolute time so all instances compute the same
+//	ticks no matter when they started.
+func Every(d time.Duration) Schedule {
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return interval(d)
+}
+
+func (i interval) Next(t time.Time) time.Time {
+	d := time.Duration(i)
+	return t.Truncate(d).Add(d)
+}
+
+// cron fields in order: minute, hour, day of month, month, day of week
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// whether day of month/week is restricted
+	domAny, dowAny bool
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var cronFields = []cronField{
+	{0, 59, nil},
+	{0, 23, nil},
+	{1, 31, nil},
+	{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	{0, 6, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var InvalidCron = errors.New("Invalid cron expression")
+
+// ParseCron parses a standard 5-field cron expression like "*/5 * * * 1-5",
+//	names of months and weekdays, and descriptors like "@hourly" are supported as well.
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if descriptor, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+	arr := strings.Fields(expr)
+	if len(arr) != len(cronFields) {
+		return nil, fmt.Errorf("%w: expect 5 fields but got %d", InvalidCron, len(arr))
+	}
+	bits := make([]uint64, len(arr))
+	for i, str := range arr {
+		b, err := parseCronField(str, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	// 7 stands for sunday as well
+	if bits[4]&(1<<7) > 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: arr[2] == "*" || arr[2] == "?",
+		dowAny: arr[4] == "*" || arr[4] == "?",
+	}, nil
+}
+
+func parseCronValue(str string, field cronField) (int, error) {
+	if v, ok := field.names[strings.ToLower(str)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", InvalidCron, str)
+	}
+	return v, nil
+}
+
+func parseCronField(str string, field cronField) (uint64, error) {
+	max := field.max
+	if field.min == 0 && max == 6 {
+		// allow 7 as sunday
+		max = 7
+	}
+	var bits uint64
+	for _, part := range strings.Split(str, ",") {
+		step := 1
+		if pos := strings.IndexByte(part, '/'); pos >= 0 {
+			s, err := strconv.Atoi(part[pos+1:])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("%w: %s", InvalidCron, part)
+			}
+			step = s
+			part = part[:pos]
+		}
+		from, to := field.min, field.max
+		switch pos := strings.IndexByte(part, '-'); {
+		case part == "*" || part == "?":
+		case pos > 0:
+			var err error
+			if from, err = parseCronValue(part[:pos], field); err != nil {
+				return 0, err
+			}
+			if to, err = parseCronValue(part[pos+1:], field); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseCronValue(part, field)
+			if err != nil {
+				return 0, err
+			}
+			from = v
+			if step == 1 {
+				to = v
+			}
+		}
+		if from < field.min || to > max || from > to {
+			return 0, fmt.Errorf("%w: %s out of range", InvalidCron, part)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) > 0
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := has(c.dom, t.Day())
+	dow := has(c.dow, int(t.Weekday()))
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	// either matches when both are restricted
+	return dom || dow
+}
+
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// give up after 5 years for impossible expressions like "0 0 30 2 *"
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(c.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
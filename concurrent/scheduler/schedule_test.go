@@ -0,0 +1,66 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvery(t *testing.T) {
+	s := Every(time.Minute)
+	base := time.Date(2020, 6, 1, 10, 30, 20, 0, time.UTC)
+	assert.Equal(t, time.Date(2020, 6, 1, 10, 31, 0, 0, time.UTC), s.Next(base))
+	assert.Equal(t, time.Date(2020, 6, 1, 10, 32, 0, 0, time.UTC), s.Next(s.Next(base)))
+}
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "a * * * *", "*/0 * * * *", "5-1 * * * *", "* * * abc *"} {
+		_, err := ParseCron(expr)
+		assert.True(t, errors.Is(err, InvalidCron), expr)
+	}
+
+	s, err := ParseCron("1,2 3-5 * jan-mar 7")
+	assert.NoError(t, err)
+	c := s.(*cronSchedule)
+	assert.Equal(t, uint64(0x6), c.minute)
+	assert.Equal(t, uint64(0x38), c.hour)
+	assert.Equal(t, uint64(0xe), c.month)
+	assert.True(t, has(c.dow, 0))
+	assert.True(t, c.domAny)
+	assert.False(t, c.dowAny)
+
+	_, err = ParseCron("@hourly")
+	assert.NoError(t, err)
+}
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2020, 6, 1, 10, 30, 20, 0, time.UTC) // monday
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2020, 6, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 6, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2020, 6, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2020, 6, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * sat", time.Date(2020, 6, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// either day of month or day of week
+		{"0 0 15 * sat", time.Date(2020, 6, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		s, err := ParseCron(c.expr)
+		assert.NoError(t, err, c.expr)
+		assert.Equal(t, c.next, s.Next(base), c.expr)
+	}
+}
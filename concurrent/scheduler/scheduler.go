@@ -0,0 +1,274 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock"
+	"github.com/prometheus/common/log"
+)
+
+// Every tick of a job is identified by {job name}@{tick timestamp in millisecond} and
+//	guarded by a distributed lock on it, plus a done mark kept for {tolerance} so an
+//	instance whose clock drifts won't execute it again.
+
+type MissedPolicy int
+
+const (
+	// MissedSkip drops the ticks missed and waits for the next one
+	MissedSkip MissedPolicy = iota
+	// MissedRunOnce executes only the latest one of the ticks missed
+	MissedRunOnce
+	// MissedRunAll executes all the ticks missed one by one
+	MissedRunAll
+)
+
+const (
+	DEFAULT_EXPIRE       = time.Minute
+	DEFAULT_HISTORY_SIZE = 100
+	DEFAULT_TOLERANCE    = time.Minute
+)
+
+var (
+	JobExisted = errors.New("Job exists already")
+	JobInvalid = errors.New("Job is invalid")
+)
+
+type Func func(ctx context.Context) error
+
+// Execution records a tick executed by current instance
+type Execution struct {
+	Job    string
+	Tick   time.Time
+	Start  time.Time
+	Finish time.Time
+	Err    error
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	policy   MissedPolicy
+	fn       Func
+	history  []Execution
+}
+
+type schedulerConfig struct {
+	historySize int
+	tolerance   time.Duration
+}
+
+type Option func(cfg *schedulerConfig)
+
+// WithHistorySize sets the max number of executions kept for each job
+func WithHistorySize(size int) Option {
+	return func(cfg *schedulerConfig) {
+		cfg.historySize = size
+	}
+}
+
+// WithTolerance sets the max clock drift between instances tolerated
+func WithTolerance(tolerance time.Duration) Option {
+	return func(cfg *schedulerConfig) {
+		cfg.tolerance = tolerance
+	}
+}
+
+type Scheduler struct {
+	sync.Mutex
+	lock      distlock.DistLock
+	store     distlock.Store
+	namespace string
+	expire    time.Duration
+	cfg       *schedulerConfig
+	jobs      map[string]*job
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	started   bool
+}
+
+// New returns a scheduler executing each tick of jobs on exactly one instance
+//	namespace is used to separate different projects
+//	expire indicates the expiration of the lock of a running tick and it's renewed during execution.
+//	store decides which storage it uses
+func New(namespace string, expire time.Duration, store distlock.Store, opts ...Option) *Scheduler {
+	cfg := &schedulerConfig{
+		historySize: DEFAULT_HISTORY_SIZE,
+		tolerance:   DEFAULT_TOLERANCE,
+	}
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	if namespace == "" {
+		namespace = "scheduler"
+	}
+	if expire <= 0 {
+		expire = DEFAULT_EXPIRE
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		lock:      distlock.NewMutex(namespace, expire, store),
+		store:     store,
+		namespace: namespace,
+		expire:    expire,
+		cfg:       cfg,
+		jobs:      make(map[string]*job),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Add registers a job which is executed at the ticks of schedule.
+//	Name of job should be identical across all instances.
+func (s *Scheduler) Add(name string, schedule Schedule, policy MissedPolicy, fn Func) error {
+	if name == "" || schedule == nil || fn == nil {
+		return JobInvalid
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return JobExisted
+	}
+	j := &job{
+		name:     name,
+		schedule: schedule,
+		policy:   policy,
+		fn:       fn,
+	}
+	s.jobs[name] = j
+	if s.started {
+		s.wg.Add(1)
+		go s.run(j)
+	}
+	return nil
+}
+
+// Start begins to schedule all jobs
+func (s *Scheduler) Start() {
+	s.Lock()
+	defer s.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.run(j)
+	}
+}
+
+// Stop cancels the running jobs and waits for them to exit
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// History returns the executions of the job on current instance from old to new
+func (s *Scheduler) History(name string) []Execution {
+	s.Lock()
+	defer s.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return nil
+	}
+	return append([]Execution(nil), j.history...)
+}
+
+func (s *Scheduler) record(j *job, e Execution) {
+	s.Lock()
+	defer s.Unlock()
+	j.history = append(j.history, e)
+	if len(j.history) > s.cfg.historySize {
+		j.history = j.history[len(j.history)-s.cfg.historySize:]
+	}
+}
+
+func (s *Scheduler) run(j *job) {
+	defer s.wg.Done()
+	next := j.schedule.Next(time.Now())
+	for !next.IsZero() {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.execute(j, next)
+		now := time.Now()
+		following := j.schedule.Next(next)
+		if !following.IsZero() && !following.After(now) {
+			switch j.policy {
+			case MissedSkip:
+				following = j.schedule.Next(now)
+			case MissedRunOnce:
+				for t := j.schedule.Next(following); !t.IsZero() && !t.After(now); t = j.schedule.Next(t) {
+					following = t
+				}
+			}
+		}
+		next = following
+	}
+}
+
+// execute runs the tick if no other instance has taken it
+func (s *Scheduler) execute(j *job, tick time.Time) {
+	target := fmt.Sprintf("%s@%d", j.name, tick.UnixNano()/1e6)
+	if !s.lock.TryLock(target) {
+		return
+	}
+	defer s.lock.UnLock(target)
+	doneKey := &distlock.LockKey{
+		Namespace: s.namespace,
+		Key:       "scheduler-done::" + target,
+	}
+	if s.store.Exists(doneKey) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(s.expire / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.lock.Keep(target)
+			}
+		}
+	}()
+	e := Execution{
+		Job:   j.name,
+		Tick:  tick,
+		Start: time.Now(),
+	}
+	e.Err = s.call(ctx, j)
+	e.Finish = time.Now()
+	cancel()
+	<-renewed
+
+	s.store.Set(doneKey, "1", s.cfg.tolerance+e.Finish.Sub(e.Start))
+	s.record(j, e)
+}
+
+func (s *Scheduler) call(ctx context.Context, j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Job %s panicked: %v", j.name, r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.fn(ctx)
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The enhanced-utils Authors. All rights reserved.
+// Use of this source code is governed by BSD
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jasonjoo2010/enhanced-utils/concurrent/distlock/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdd(t *testing.T) {
+	s := New("test", time.Second, mock.New())
+	fn := func(ctx context.Context) error { return nil }
+	assert.Equal(t, JobInvalid, s.Add("", Every(time.Second), MissedSkip, fn))
+	assert.Equal(t, JobInvalid, s.Add("a", nil, MissedSkip, fn))
+	assert.NoError(t, s.Add("a", Every(time.Second), MissedSkip, fn))
+	assert.Equal(t, JobExisted, s.Add("a", Every(time.Second), MissedSkip, fn))
+	assert.Nil(t, s.History("b"))
+}
+
+func TestSingleton(t *testing.T) {
+	store := mock.New()
+	lock := sync.Mutex{}
+	ticks := make(map[time.Time]int)
+	var schedulers []*Scheduler
+	for i := 0; i < 3; i++ {
+		s := New("test", time.Second, store)
+		s.Add("job", Every(100*time.Millisecond), MissedSkip, func(ctx context.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+			ticks[time.Now().Truncate(100*time.Millisecond)]++
+			return errors.New("failed")
+		})
+		s.Start()
+		schedulers = append(schedulers, s)
+	}
+	time.Sleep(time.Second)
+	total := 0
+	for _, s := range schedulers {
+		s.Stop()
+		for _, e := range s.History("job") {
+			assert.EqualError(t, e.Err, "failed")
+			assert.False(t, e.Finish.Before(e.Start))
+		}
+		total += len(s.History("job"))
+	}
+	assert.True(t, total >= 8)
+	assert.Equal(t, len(ticks), total)
+	for _, cnt := range ticks {
+		assert.Equal(t, 1, cnt)
+	}
+}
+
+func TestMissed(t *testing.T) {
+	run := func(policy MissedPolicy) []Execution {
+		s := New("test", time.Second, mock.New(), WithHistorySize(3))
+		s.Add("job", Every(100*time.Millisecond), policy, func(ctx context.Context) error {
+			time.Sleep(250 * time.Millisecond)
+			return nil
+		})
+		s.Start()
+		time.Sleep(1200 * time.Millisecond)
+		s.Stop()
+		return s.History("job")
+	}
+
+	// always wait for the next tick
+	history := run(MissedSkip)
+	assert.Equal(t, 3, len(history))
+	for i, e := range history {
+		assert.True(t, e.Start.Sub(e.Tick) < 50*time.Millisecond)
+		if i > 0 {
+			assert.True(t, e.Tick.Sub(history[i-1].Tick) >= 300*time.Millisecond)
+		}
+	}
+
+	// the latest missed tick is executed immediately
+	history = run(MissedRunOnce)
+	for i, e := range history {
+		assert.True(t, e.Start.Sub(e.Tick) < 100*time.Millisecond)
+		if i > 0 {
+			assert.True(t, e.Tick.Sub(history[i-1].Tick) >= 200*time.Millisecond)
+			assert.True(t, e.Start.Sub(history[i-1].Finish) < 50*time.Millisecond)
+		}
+	}
+
+	// executed one by one
+	history = run(MissedRunAll)
+	for i, e := range history {
+		if i > 0 {
+			assert.Equal(t, 100*time.Millisecond, e.Tick.Sub(history[i-1].Tick))
+		}
+	}
+}
+
+func TestPanic(t *testing.T) {
+	s := New("test", time.Second, mock.New())
+	s.Start()
+	s.Add("job", Every(100*time.Millisecond), MissedSkip, func(ctx context.Context) error {
+		panic("oops")
+	})
+	time.Sleep(250 * time.Millisecond)
+	s.Stop()
+	history := s.History("job")
+	assert.True(t, len(history) > 0)
+	assert.EqualError(t, history[0].Err, "panic: oops")
+}
@@ -5,6 +5,7 @@ go 1.14
 require (
 	github.com/google/go-cmp v0.4.0 // indirect
 	github.com/prometheus/common v0.9.1
+	github.com/sirupsen/logrus v1.4.2
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/sys v0.0.0-20191120155948-bd437916bb0e // indirect
 	gotest.tools v2.2.0+incompatible